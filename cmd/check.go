@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/overmindtech/nginx-source/sources"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check [config file]",
+	Short: "Checks an nginx config against the policy rules",
+	Long: `Checks an nginx config against the rules in the policy file and prints
+any violations. The config file can either be a normal nginx config, in which
+case includes will be followed, or the output of "nginx -T".
+
+Exits with a non-zero exit code if there are any violations
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		policyFile := viper.GetString("policy-file")
+
+		if policyFile == "" {
+			log.Fatal("policy-file is required")
+		}
+
+		policy, err := sources.LoadPolicy(policyFile)
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":       err,
+				"policy-file": policyFile,
+			}).Fatal("Error loading policy rules")
+		}
+
+		violations, err := policy.EvaluateFile(context.Background(), args[0])
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  args[0],
+			}).Fatal("Error checking config")
+		}
+
+		for _, v := range violations {
+			fmt.Printf("%v:%v: [%v] %v: %v\n", v.File, v.Line, v.Severity, v.Rule, v.Message)
+		}
+
+		if len(violations) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
@@ -39,6 +39,10 @@ var rootCmd = &cobra.Command{
 		natsJWT := viper.GetString("nats-jwt")
 		natsNKeySeed := viper.GetString("nats-nkey-seed")
 		maxParallel := viper.GetInt("max-parallel")
+		policyFile := viper.GetString("policy-file")
+		advisoriesFile := viper.GetString("advisories-file")
+		instanceTTL := viper.GetDuration("instance-ttl")
+		kubernetesCluster := viper.GetString("kubernetes-cluster")
 		hostname, err := os.Hostname()
 
 		if err != nil {
@@ -57,11 +61,15 @@ var rootCmd = &cobra.Command{
 		}
 
 		log.WithFields(log.Fields{
-			"nats-servers":     natsServers,
-			"nats-name-prefix": natsNamePrefix,
-			"max-parallel":     maxParallel,
-			"nats-jwt":         natsJWT,
-			"nats-nkey-seed":   natsNKeySeedLog,
+			"nats-servers":       natsServers,
+			"nats-name-prefix":   natsNamePrefix,
+			"max-parallel":       maxParallel,
+			"nats-jwt":           natsJWT,
+			"nats-nkey-seed":     natsNKeySeedLog,
+			"policy-file":        policyFile,
+			"advisories-file":    advisoriesFile,
+			"instance-ttl":       instanceTTL,
+			"kubernetes-cluster": kubernetesCluster,
 		}).Info("Got config")
 
 		// Validate the auth params and create a token client if we are using
@@ -78,6 +86,32 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
+		var policy *sources.Policy
+
+		if policyFile != "" {
+			policy, err = sources.LoadPolicy(policyFile)
+
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":       err,
+					"policy-file": policyFile,
+				}).Fatal("Error loading policy rules")
+			}
+		}
+
+		var advisories []sources.Advisory
+
+		if advisoriesFile != "" {
+			advisories, err = sources.LoadAdvisories(advisoriesFile)
+
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":           err,
+					"advisories-file": advisoriesFile,
+				}).Fatal("Error loading security advisories")
+			}
+		}
+
 		e := discovery.Engine{
 			Name: "kubernetes-source",
 			NATSOptions: &multiconn.NATSConnectionOptions{
@@ -97,8 +131,15 @@ var rootCmd = &cobra.Command{
 		}
 
 		e.AddSources(&sources.NginxSource{
+			Engine:            &e,
+			Policy:            policy,
+			Advisories:        advisories,
+			InstanceTTL:       instanceTTL,
+			KubernetesCluster: kubernetesCluster,
+		}, &sources.NginxConfigSource{
 			Engine: &e,
-		})
+			Policy: policy,
+		}, &sources.NginxServerSource{}, &sources.NginxLocationSource{})
 
 		// Register triggers
 		e.AddTriggers(triggers.AllTriggers...)
@@ -195,9 +236,11 @@ func init() {
 	rootCmd.PersistentFlags().String("nats-nkey-seed", "", "The NKey seed which corresponds to the NATS JWT e.g. SUAFK6QUC...")
 	rootCmd.PersistentFlags().Int("max-parallel", (runtime.NumCPU() * 2), "Max number of requests to run in parallel")
 
-	// ⚠️ Add your own custom config options below, the example "your-custom-flag"
-	// should be replaced with your own config or deleted
-	rootCmd.PersistentFlags().String("your-custom-flag", "someDefaultValue.conf", "Description of what your option is meant to do")
+	// Source-specific config
+	rootCmd.PersistentFlags().String("policy-file", "", "Path to a YAML file containing policy rules that nginx configs will be checked against")
+	rootCmd.PersistentFlags().String("advisories-file", "", "Path to a JSON file of nginx security advisories to use instead of the bundled dataset")
+	rootCmd.PersistentFlags().Duration("instance-ttl", sources.DefaultInstanceTTL, "How long discovered nginx instances are returned by Find after they were last seen")
+	rootCmd.PersistentFlags().String("kubernetes-cluster", "", "The name of the Kubernetes cluster, used to link ingress-nginx config to the Ingresses and Services in the cluster's namespaces")
 
 	// Bind these to viper
 	viper.BindPFlags(rootCmd.PersistentFlags())
@@ -62,6 +62,20 @@ type Response struct {
 }
 
 func Parse(ctx context.Context, content string) (Response, error) {
+	return parseContent(ctx, content)
+}
+
+// ParseSingle Parses config without following includes, for config that
+// doesn't come from the local filesystem
+func ParseSingle(ctx context.Context, content string) (Response, error) {
+	return parseContent(ctx, content, "--single-file")
+}
+
+func ParseFile(ctx context.Context, filePath string) (Response, error) {
+	return parseFile(ctx, filePath)
+}
+
+func parseContent(ctx context.Context, content string, args ...string) (Response, error) {
 	var tempFile *os.File
 	var err error
 
@@ -79,19 +93,15 @@ func Parse(ctx context.Context, content string) (Response, error) {
 		return Response{}, err
 	}
 
-	return ParseFile(ctx, tempFile.Name())
+	return parseFile(ctx, tempFile.Name(), args...)
 }
 
-func ParseFile(ctx context.Context, filePath string) (Response, error) {
+func parseFile(ctx context.Context, filePath string, args ...string) (Response, error) {
 	var out []byte
 	var err error
 	var response Response
 
-	if err != nil {
-		return response, err
-	}
-
-	cmd := exec.CommandContext(ctx, "crossplane", "parse", filePath)
+	cmd := exec.CommandContext(ctx, "crossplane", append([]string{"parse"}, append(args, filePath)...)...)
 
 	out, err = cmd.Output()
 
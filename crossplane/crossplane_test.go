@@ -39,3 +39,50 @@ func TestParse(t *testing.T) {
 
 	t.Log(response)
 }
+
+func TestWalk(t *testing.T) {
+	directives := []Directive{
+		{
+			Directive: "http",
+			Block: []Directive{
+				{
+					Directive: "server",
+					Block: []Directive{
+						{Directive: "listen", Args: []string{"80"}},
+						{Directive: "location", Args: []string{"/"}, Block: []Directive{
+							{Directive: "root", Args: []string{"/var/www"}},
+						}},
+					},
+				},
+			},
+		},
+	}
+
+	var visited []string
+
+	Walk(directives, func(d Directive, parents []Directive) {
+		if d.Directive == "root" && len(parents) != 3 {
+			t.Errorf("expected root to have 3 parents, got %v", len(parents))
+		}
+
+		visited = append(visited, d.Directive)
+	})
+
+	if len(visited) != 5 {
+		t.Errorf("expected 5 directives to be visited, got %v", visited)
+	}
+
+	resp := Response{Config: []Config{{Parsed: directives}}}
+
+	if found := resp.Directives("root"); len(found) != 1 {
+		t.Errorf("expected 1 root directive, got %v", found)
+	}
+
+	if children := directives[0].Block[0].Children("listen"); len(children) != 1 {
+		t.Errorf("expected 1 listen directive, got %v", children)
+	}
+
+	if descendants := directives[0].Descendants("root"); len(descendants) != 1 {
+		t.Errorf("expected 1 descendant root directive, got %v", descendants)
+	}
+}
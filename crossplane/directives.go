@@ -0,0 +1,69 @@
+package crossplane
+
+// WalkFunc is called for each directive visited by Walk. The parents are the
+// enclosing block directives, outermost first
+type WalkFunc func(d Directive, parents []Directive)
+
+// Walk Calls fn for every directive in the list, recursing into blocks
+func Walk(directives []Directive, fn WalkFunc) {
+	walk(directives, nil, fn)
+}
+
+func walk(directives []Directive, parents []Directive, fn WalkFunc) {
+	for _, d := range directives {
+		fn(d, parents)
+
+		if len(d.Block) > 0 {
+			// Copy the parents so that callers can keep a reference to the
+			// slice without it being modified by later calls
+			childParents := make([]Directive, len(parents), len(parents)+1)
+			copy(childParents, parents)
+
+			walk(d.Block, append(childParents, d), fn)
+		}
+	}
+}
+
+// Children Returns the directives within this block with the given name. This
+// does not recurse into nested blocks
+func (d Directive) Children(name string) []Directive {
+	var children []Directive
+
+	for _, child := range d.Block {
+		if child.Directive == name {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// Descendants Returns all directives within this block with the given name,
+// including those in nested blocks
+func (d Directive) Descendants(name string) []Directive {
+	var found []Directive
+
+	Walk(d.Block, func(child Directive, parents []Directive) {
+		if child.Directive == name {
+			found = append(found, child)
+		}
+	})
+
+	return found
+}
+
+// Directives Returns all directives with the given name from all config files
+// in the response, regardless of how deeply they are nested
+func (r Response) Directives(name string) []Directive {
+	var found []Directive
+
+	for _, config := range r.Config {
+		Walk(config.Parsed, func(d Directive, parents []Directive) {
+			if d.Directive == name {
+				found = append(found, d)
+			}
+		})
+	}
+
+	return found
+}
@@ -0,0 +1,107 @@
+package sources
+
+import (
+	"strings"
+)
+
+// NginxBuildProfile The configure arguments from `nginx -V` parsed into the
+// details of how nginx was built
+type NginxBuildProfile struct {
+	// Install paths
+	Prefix       string
+	SbinPath     string
+	ConfPath     string
+	ErrorLogPath string
+	HTTPLogPath  string
+	PidPath      string
+	LockPath     string
+	ModulesPath  string
+
+	// The default user and group that worker processes run as
+	User  string
+	Group string
+
+	// Extra compiler and linker options
+	CCOpt string
+	LDOpt string
+
+	// Optional built-in modules that were enabled e.g. `http_ssl_module`
+	EnabledModules []string
+
+	// Built-in modules that were built as dynamic modules
+	DynamicModules []string
+
+	// Default modules that were disabled e.g. `http_autoindex_module`
+	DisabledModules []string
+
+	// Paths to the source of third-party modules, built statically and
+	// dynamically
+	AddModules        []string
+	AddDynamicModules []string
+
+	// Build features that aren't modules e.g. `threads` or `compat`
+	Features []string
+
+	// Any other arguments, such as temp paths or library sources
+	Other []string
+}
+
+// parseBuildProfile Parses the configure arguments from `nginx -V`
+func parseBuildProfile(configArgs []string) NginxBuildProfile {
+	var profile NginxBuildProfile
+
+	paths := map[string]*string{
+		"--prefix":         &profile.Prefix,
+		"--sbin-path":      &profile.SbinPath,
+		"--conf-path":      &profile.ConfPath,
+		"--error-log-path": &profile.ErrorLogPath,
+		"--http-log-path":  &profile.HTTPLogPath,
+		"--pid-path":       &profile.PidPath,
+		"--lock-path":      &profile.LockPath,
+		"--modules-path":   &profile.ModulesPath,
+		"--user":           &profile.User,
+		"--group":          &profile.Group,
+		"--with-cc-opt":    &profile.CCOpt,
+		"--with-ld-opt":    &profile.LDOpt,
+	}
+
+	for _, arg := range configArgs {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(arg), "=")
+		value = strings.Trim(value, `'"`)
+
+		if field, ok := paths[name]; ok {
+			*field = value
+			continue
+		}
+
+		switch {
+		case name == "--add-module":
+			profile.AddModules = append(profile.AddModules, value)
+		case name == "--add-dynamic-module":
+			profile.AddDynamicModules = append(profile.AddDynamicModules, value)
+		case strings.HasPrefix(name, "--without-"):
+			profile.DisabledModules = append(profile.DisabledModules, strings.TrimPrefix(name, "--without-"))
+		case strings.HasPrefix(name, "--with-") && isModuleArg(name):
+			module := strings.TrimPrefix(name, "--with-")
+
+			if value == "dynamic" {
+				profile.DynamicModules = append(profile.DynamicModules, module)
+			} else {
+				profile.EnabledModules = append(profile.EnabledModules, module)
+			}
+		case strings.HasPrefix(name, "--with-") && !hasValue:
+			profile.Features = append(profile.Features, strings.TrimPrefix(name, "--with-"))
+		default:
+			profile.Other = append(profile.Other, arg)
+		}
+	}
+
+	return profile
+}
+
+// isModuleArg Returns whether a `--with-` argument enables a module rather
+// than a feature or library. `mail` and `stream` enable whole subsystems of
+// modules so are treated as modules themselves
+func isModuleArg(name string) bool {
+	return strings.HasSuffix(name, "_module") || name == "--with-mail" || name == "--with-stream"
+}
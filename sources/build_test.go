@@ -0,0 +1,75 @@
+package sources
+
+import (
+	"testing"
+)
+
+func TestParseBuildProfile(t *testing.T) {
+	profile := parseBuildProfile([]string{
+		"--prefix=/etc/nginx",
+		"--sbin-path=/usr/sbin/nginx",
+		"--modules-path=/usr/lib/nginx/modules",
+		"--conf-path=/etc/nginx/nginx.conf",
+		"--error-log-path=/var/log/nginx/error.log",
+		"--pid-path=/var/run/nginx.pid",
+		"--http-client-body-temp-path=/var/cache/nginx/client_temp",
+		"--user=nginx",
+		"--group=nginx",
+		"--with-compat",
+		"--with-threads",
+		"--with-http_ssl_module",
+		"--with-http_v2_module",
+		"--with-http_perl_module=dynamic",
+		"--with-stream=dynamic",
+		"--with-mail",
+		"--without-http_autoindex_module",
+		"--with-openssl=../openssl-3.0.13",
+		"--add-module=/build/headers-more-nginx-module",
+		"--add-dynamic-module=/build/njs/nginx",
+		"--with-cc-opt='-g -O2 -fPIC'",
+		"--with-ld-opt='-Wl,-z,relro'",
+	})
+
+	stringTests := map[string][2]string{
+		"Prefix":       {profile.Prefix, "/etc/nginx"},
+		"SbinPath":     {profile.SbinPath, "/usr/sbin/nginx"},
+		"ModulesPath":  {profile.ModulesPath, "/usr/lib/nginx/modules"},
+		"ConfPath":     {profile.ConfPath, "/etc/nginx/nginx.conf"},
+		"ErrorLogPath": {profile.ErrorLogPath, "/var/log/nginx/error.log"},
+		"PidPath":      {profile.PidPath, "/var/run/nginx.pid"},
+		"User":         {profile.User, "nginx"},
+		"Group":        {profile.Group, "nginx"},
+		"CCOpt":        {profile.CCOpt, "-g -O2 -fPIC"},
+		"LDOpt":        {profile.LDOpt, "-Wl,-z,relro"},
+	}
+
+	for field, values := range stringTests {
+		if values[0] != values[1] {
+			t.Errorf("expected %v to be %v, got %v", field, values[1], values[0])
+		}
+	}
+
+	sliceTests := map[string][2][]string{
+		"EnabledModules":    {profile.EnabledModules, {"http_ssl_module", "http_v2_module", "mail"}},
+		"DynamicModules":    {profile.DynamicModules, {"http_perl_module", "stream"}},
+		"DisabledModules":   {profile.DisabledModules, {"http_autoindex_module"}},
+		"AddModules":        {profile.AddModules, {"/build/headers-more-nginx-module"}},
+		"AddDynamicModules": {profile.AddDynamicModules, {"/build/njs/nginx"}},
+		"Features":          {profile.Features, {"compat", "threads"}},
+		"Other":             {profile.Other, {"--http-client-body-temp-path=/var/cache/nginx/client_temp", "--with-openssl=../openssl-3.0.13"}},
+	}
+
+	for field, values := range sliceTests {
+		if len(values[0]) != len(values[1]) {
+			t.Errorf("expected %v to be %v, got %v", field, values[1], values[0])
+			continue
+		}
+
+		for i := range values[0] {
+			if values[0][i] != values[1][i] {
+				t.Errorf("expected %v to be %v, got %v", field, values[1], values[0])
+				break
+			}
+		}
+	}
+}
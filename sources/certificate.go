@@ -0,0 +1,322 @@
+package sources
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/sdp-go"
+)
+
+// CertificateInfo Details of a certificate referenced by an `ssl_certificate`
+// directive. The details are those of the leaf certificate, which is always
+// the first in the file
+type CertificateInfo struct {
+	Path        string
+	Subject     string
+	Issuer      string
+	SANs        []string
+	NotBefore   time.Time
+	NotAfter    time.Time
+	ChainLength int
+
+	// The raw PEM content of the file, this is used to link to the
+	// `certificate` item and isn't included in the attributes
+	pem string
+}
+
+// CertificateMismatch A server_name that is not covered by the SANs of a
+// certificate that the server uses
+type CertificateMismatch struct {
+	ServerName  string
+	Certificate string
+	Line        int
+}
+
+// parseCertificate Parses the contents of a PEM file as returned by the
+// `ssl_certificate` directive. These files can contain the full chain so the
+// number of certificates is recorded, however only the first is inspected
+func parseCertificate(path string, pemString string) (CertificateInfo, error) {
+	info := CertificateInfo{
+		Path: path,
+		pem:  pemString,
+	}
+
+	var certs []*x509.Certificate
+	rest := []byte(pemString)
+
+	for {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+
+		if block == nil {
+			break
+		}
+
+		// Key files can be concatenated with the certificate so ignore
+		// anything else
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+
+		if err != nil {
+			return info, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return info, errors.New("no certificates found in PEM data")
+	}
+
+	leaf := certs[0]
+
+	info.Subject = leaf.Subject.String()
+	info.Issuer = leaf.Issuer.String()
+	info.NotBefore = leaf.NotBefore
+	info.NotAfter = leaf.NotAfter
+	info.ChainLength = len(certs)
+	info.SANs = append(info.SANs, leaf.DNSNames...)
+
+	for _, ip := range leaf.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+
+	return info, nil
+}
+
+// certificatePaths Returns the unique paths of all certificates in the config,
+// resolved to absolute paths. Paths that contain variables or inline `data:`
+// certificates can't be read from disk so are ignored
+func certificatePaths(resp crossplane.Response, resolver pathResolver) []string {
+	var paths []string
+	seen := make(map[string]bool)
+
+	for _, d := range resp.Directives("ssl_certificate") {
+		if len(d.Args) == 0 {
+			continue
+		}
+
+		if !isFilePath(d.Args[0]) {
+			continue
+		}
+
+		path := resolver.Resolve(d.Args[0], true)
+
+		if seen[path] {
+			continue
+		}
+
+		seen[path] = true
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// readCertificates Reads the certificates at the given paths using the
+// `command` source and parses them. Certificates that can't be read or parsed
+// are returned as errors rather than stopping the rest of the nginx details
+// being returned, in the same order as the paths
+func (s *NginxSource) readCertificates(itemContext string, instance NginxInstance, paths []string) (map[string]CertificateInfo, []CollectionError) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	certs := make(map[string]CertificateInfo)
+	failures := make([]*CollectionError, len(paths))
+
+	for i, path := range paths {
+		wg.Add(1)
+
+		go func(i int, path string) {
+			defer wg.Done()
+
+			command := instance.Exec(fmt.Sprintf("cat %v", shellQuote(path)))
+			info, collectionErr := s.readCertificate(itemContext, command, path)
+
+			if collectionErr != nil {
+				failures[i] = collectionErr
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			certs[path] = info
+		}(i, path)
+	}
+
+	wg.Wait()
+
+	var collectionErrors []CollectionError
+
+	for _, failure := range failures {
+		if failure != nil {
+			collectionErrors = append(collectionErrors, *failure)
+		}
+	}
+
+	return certs, collectionErrors
+}
+
+// readCertificate Runs a command that prints a certificate and parses it
+func (s *NginxSource) readCertificate(itemContext string, command string, path string) (CertificateInfo, *CollectionError) {
+	items, errs, err := s.runCommand(itemContext, command)
+	item, collectionErr := singleItem(command, items, errs, err)
+
+	if collectionErr != nil {
+		return CertificateInfo{}, collectionErr
+	}
+
+	if exitCode, err := commandExitCode(item); err == nil && exitCode != 0 {
+		return CertificateInfo{}, &CollectionError{
+			Command: command,
+			Type:    CollectionErrorFailed,
+			Error:   fmt.Sprintf("exit code %v: %v", exitCode, strings.TrimSpace(commandOutput(item, "stderr"))),
+		}
+	}
+
+	info, err := parseCertificate(path, commandOutput(item, "stdout"))
+
+	if err != nil {
+		return CertificateInfo{}, &CollectionError{
+			Command: command,
+			Type:    CollectionErrorFailed,
+			Error:   fmt.Sprintf("error parsing certificate: %v", err),
+		}
+	}
+
+	return info, nil
+}
+
+// certificateLinks Returns requests that will link the nginx item to the
+// `certificate` items for each certificate that was read, in the same order as
+// the certificates so that the links don't change between runs
+func certificateLinks(itemContext string, certs []CertificateInfo) []*sdp.ItemRequest {
+	var links []*sdp.ItemRequest
+
+	for _, cert := range certs {
+		links = append(links, &sdp.ItemRequest{
+			Type:    "certificate",
+			Method:  sdp.RequestMethod_SEARCH,
+			Query:   cert.pem,
+			Context: itemContext,
+		})
+	}
+
+	return links
+}
+
+// findCertificateMismatches Checks every server block that uses a certificate
+// and returns the server names that aren't covered by that certificate's SANs.
+// Servers that don't set a certificate inherit it from the enclosing block.
+// Only servers that accept TLS are checked, since plain HTTP servers inherit
+// the certificate without using it
+func findCertificateMismatches(resp crossplane.Response, certs map[string]CertificateInfo, resolver pathResolver) []CertificateMismatch {
+	var mismatches []CertificateMismatch
+
+	for _, config := range resp.Config {
+		crossplane.Walk(config.Parsed, func(d crossplane.Directive, parents []crossplane.Directive) {
+			if d.Directive != "server" || len(d.Block) == 0 || !acceptsTLS(d, parents) {
+				return
+			}
+
+			certDirectives := d.Children("ssl_certificate")
+
+			for i := len(parents) - 1; i >= 0 && len(certDirectives) == 0; i-- {
+				certDirectives = parents[i].Children("ssl_certificate")
+			}
+
+			for _, certDirective := range certDirectives {
+				if len(certDirective.Args) == 0 {
+					continue
+				}
+
+				cert, ok := certs[resolver.Resolve(certDirective.Args[0], true)]
+
+				if !ok {
+					continue
+				}
+
+				for _, nameDirective := range d.Children("server_name") {
+					for _, name := range nameDirective.Args {
+						if !certificateCovers(cert, name) {
+							mismatches = append(mismatches, CertificateMismatch{
+								ServerName:  name,
+								Certificate: cert.Path,
+								Line:        nameDirective.Line,
+							})
+						}
+					}
+				}
+			}
+		})
+	}
+
+	return mismatches
+}
+
+// acceptsTLS Returns whether a server accepts TLS connections, either by
+// listening with `ssl` or `quic`, or with the legacy `ssl on` directive which
+// is inherited from the enclosing block
+func acceptsTLS(server crossplane.Directive, parents []crossplane.Directive) bool {
+	for _, listen := range server.Children("listen") {
+		if hasArg(listen, "ssl") || hasArg(listen, "quic") {
+			return true
+		}
+	}
+
+	blocks := append([]crossplane.Directive{server}, parents...)
+
+	for _, block := range blocks {
+		for _, ssl := range block.Children("ssl") {
+			if hasArg(ssl, "on") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// certificateCovers Returns whether the certificate is valid for the given
+// server_name. Names that can't be checked such as regexes, the catch-all `_`
+// and trailing wildcards are always considered covered
+func certificateCovers(cert CertificateInfo, serverName string) bool {
+	name := strings.ToLower(serverName)
+
+	if name == "" || name == "_" || strings.HasPrefix(name, "~") || strings.HasSuffix(name, ".*") || strings.Contains(name, "$") {
+		return true
+	}
+
+	// A leading dot matches both the domain and all of its subdomains
+	if strings.HasPrefix(name, ".") {
+		return certificateCovers(cert, name[1:]) && certificateCovers(cert, "*"+name)
+	}
+
+	for _, san := range cert.SANs {
+		san = strings.ToLower(san)
+
+		if san == name {
+			return true
+		}
+
+		// Wildcard SANs match exactly one label
+		if strings.HasPrefix(san, "*.") && !strings.HasPrefix(name, "*.") {
+			if i := strings.Index(name, "."); i > 0 && name[i:] == san[1:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,217 @@
+package sources
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// testCertificatePEM Generates a self-signed certificate for the given names
+func testCertificatePEM(t *testing.T, names ...string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestParseCertificate(t *testing.T) {
+	leaf := testCertificatePEM(t, "example.com", "*.example.com")
+	chain := leaf + testCertificatePEM(t, "intermediate")
+
+	info, err := parseCertificate("/etc/ssl/example.pem", chain)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "CN=example.com"; info.Subject != expected {
+		t.Errorf("expected Subject to be %v, got %v", expected, info.Subject)
+	}
+
+	if info.ChainLength != 2 {
+		t.Errorf("expected ChainLength to be 2, got %v", info.ChainLength)
+	}
+
+	if len(info.SANs) != 2 {
+		t.Errorf("expected 2 SANs, got %v", info.SANs)
+	}
+
+	if info.NotAfter.Before(time.Now()) {
+		t.Errorf("expected NotAfter to be in the future, got %v", info.NotAfter)
+	}
+
+	if _, err := parseCertificate("/etc/ssl/empty.pem", "not a cert"); err == nil {
+		t.Error("expected error parsing invalid PEM data, got nil")
+	}
+}
+
+func TestCertificateCovers(t *testing.T) {
+	cert := CertificateInfo{
+		SANs: []string{"example.com", "*.example.com"},
+	}
+
+	tests := map[string]bool{
+		"example.com":        true,
+		"www.example.com":    true,
+		"WWW.Example.com":    true,
+		"a.b.example.com":    false,
+		"example.org":        false,
+		"*.example.com":      true,
+		".example.com":       true,
+		".example.org":       false,
+		"_":                  true,
+		"~^(www\\.)?foo$":    true,
+		"www.*":              true,
+		"$hostname":          true,
+		"other.example.org.": false,
+	}
+
+	for name, expected := range tests {
+		if covered := certificateCovers(cert, name); covered != expected {
+			t.Errorf("expected %v covered to be %v, got %v", name, expected, covered)
+		}
+	}
+}
+
+func TestFindCertificateMismatches(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "http",
+						Block: []crossplane.Directive{
+							{Directive: "ssl_certificate", Args: []string{"/etc/ssl/default.pem"}},
+							{
+								Directive: "server",
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"443", "ssl"}, Line: 4},
+									{Directive: "server_name", Args: []string{"example.com", "www.example.org"}, Line: 5},
+									{Directive: "ssl_certificate", Args: []string{"/etc/ssl/example.pem"}},
+								},
+							},
+							{
+								Directive: "server",
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"[::]:443", "quic"}, Line: 9},
+									{Directive: "server_name", Args: []string{"other.com"}, Line: 10},
+								},
+							},
+							{
+								// Plain HTTP servers inherit the certificate
+								// without using it
+								Directive: "server",
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"80"}, Line: 14},
+									{Directive: "server_name", Args: []string{"plain.com"}, Line: 15},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	certs := map[string]CertificateInfo{
+		"/etc/ssl/example.pem": {Path: "/etc/ssl/example.pem", SANs: []string{"example.com"}},
+		"/etc/ssl/default.pem": {Path: "/etc/ssl/default.pem", SANs: []string{"default.com"}},
+	}
+
+	if paths := certificatePaths(resp, pathResolver{}); len(paths) != 2 {
+		t.Errorf("expected 2 certificate paths, got %v", paths)
+	}
+
+	mismatches := findCertificateMismatches(resp, certs, pathResolver{})
+
+	if len(mismatches) != 2 {
+		t.Fatalf("expected 2 mismatches, got %v", mismatches)
+	}
+
+	if mismatches[0].ServerName != "www.example.org" || mismatches[0].Certificate != "/etc/ssl/example.pem" || mismatches[0].Line != 5 {
+		t.Errorf("unexpected mismatch %+v", mismatches[0])
+	}
+
+	// The second server inherits the certificate from the http block
+	if mismatches[1].ServerName != "other.com" || mismatches[1].Certificate != "/etc/ssl/default.pem" {
+		t.Errorf("unexpected mismatch %+v", mismatches[1])
+	}
+}
+
+func TestCertificateLinks(t *testing.T) {
+	certs := []CertificateInfo{
+		{Path: "/etc/ssl/b.pem", pem: "b"},
+		{Path: "/etc/ssl/a.pem", pem: "a"},
+		{Path: "/etc/ssl/c.pem", pem: "c"},
+	}
+
+	links := certificateLinks("test", certs)
+
+	if len(links) != 3 {
+		t.Fatalf("expected 3 links, got %v", links)
+	}
+
+	for i, cert := range certs {
+		if links[i].Query != cert.pem || links[i].Type != "certificate" {
+			t.Errorf("expected link %v to be for %v, got %v", i, cert.Path, links[i])
+		}
+	}
+}
+
+func TestReadCertificates(t *testing.T) {
+	commands := &TestNginxCommandSource{
+		Outputs: map[string]string{
+			`^cat /etc/ssl/example.pem$`: testCertificatePEM(t, "example.com"),
+		},
+		Failures: map[string]string{
+			`^cat /etc/ssl/missing.pem$`: "cat: /etc/ssl/missing.pem: No such file or directory\n",
+		},
+	}
+
+	source := NginxSource{run: commands.Run}
+	paths := []string{"/etc/ssl/example.pem", "/etc/ssl/missing.pem", "/etc/ssl/unknown.pem"}
+
+	certs, collectionErrors := source.readCertificates("test", NginxInstance{}, paths)
+
+	if len(certs) != 1 || certs["/etc/ssl/example.pem"].Subject == "" {
+		t.Errorf("expected only /etc/ssl/example.pem to be read, got %v", certs)
+	}
+
+	if len(collectionErrors) != 2 {
+		t.Fatalf("expected 2 collection errors, got %v", collectionErrors)
+	}
+
+	if e := collectionErrors[0]; e.Command != "cat /etc/ssl/missing.pem" || e.Type != CollectionErrorFailed || !strings.Contains(e.Error, "No such file") {
+		t.Errorf("unexpected collection error %+v", e)
+	}
+
+	if e := collectionErrors[1]; e.Command != "cat /etc/ssl/unknown.pem" || e.Type != CollectionErrorNotFound {
+		t.Errorf("unexpected collection error %+v", e)
+	}
+}
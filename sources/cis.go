@@ -0,0 +1,570 @@
+package sources
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+const (
+	CISPass   = "pass"
+	CISFail   = "fail"
+	CISManual = "manual"
+)
+
+// CISResult The result of a single recommendation from the CIS NGINX
+// Benchmark
+type CISResult struct {
+	ID     string
+	Title  string
+	Status string
+	Detail string
+}
+
+// CISReport The results of all recommendations for a single instance
+type CISReport struct {
+	Results []CISResult
+	Passed  int
+	Failed  int
+	Manual  int
+}
+
+// cisInput The data that the checks are run against
+type cisInput struct {
+	// The whole config as a single block
+	Config crossplane.Directive
+
+	// The configure arguments from `nginx -V`, if they could be found
+	ConfigArgs []string
+}
+
+// cisCheck A recommendation from the benchmark. Recommendations that can't be
+// checked automatically e.g. file permissions have no check function and are
+// always reported as manual
+type cisCheck struct {
+	ID    string
+	Title string
+	Check func(in cisInput) (string, string)
+}
+
+var cisChecks = []cisCheck{
+	{ID: "2.1.2", Title: "Ensure HTTP WebDAV module is not installed", Check: cisModuleNotInstalled("--with-http_dav_module")},
+	{ID: "2.1.3", Title: "Ensure modules with gzip functionality are disabled", Check: cisGzipDisabled},
+	{ID: "2.1.4", Title: "Ensure the autoindex module is disabled", Check: cisDirectiveNot("autoindex", "on")},
+	{ID: "2.2.1", Title: "Ensure that NGINX is run using a non-privileged, dedicated service account", Check: cisNonRootUser},
+	{ID: "2.3.2", Title: "Ensure access to NGINX directories and files is restricted"},
+	{ID: "2.4.1", Title: "Ensure NGINX only listens for network connections on authorized ports"},
+	{ID: "2.4.2", Title: "Ensure requests for unknown host names are rejected", Check: cisUnknownHostsRejected},
+	{ID: "2.4.3", Title: "Ensure keepalive_timeout is 10 seconds or less, but not 0", Check: cisTimeout("keepalive_timeout")},
+	{ID: "2.4.4", Title: "Ensure send_timeout is set to 10 seconds or less, but not 0", Check: cisTimeout("send_timeout")},
+	{ID: "2.5.1", Title: "Ensure server_tokens directive is set to `off`", Check: cisServerTokensOff},
+	{ID: "2.5.2", Title: "Ensure default error and index.html pages do not reference NGINX"},
+	{ID: "2.5.3", Title: "Ensure hidden file serving is disabled", Check: cisHiddenFilesDisabled},
+	{ID: "2.5.4", Title: "Ensure the NGINX reverse proxy does not enable information disclosure", Check: cisProxyRequires("proxy_hide_header", "X-Powered-By", "Server")},
+	{ID: "3.1", Title: "Ensure detailed logging is enabled", Check: cisDirectiveSet("log_format")},
+	{ID: "3.2", Title: "Ensure access logging is enabled", Check: cisDirectiveNot("access_log", "off")},
+	{ID: "3.3", Title: "Ensure error logging is enabled and set to the info logging level", Check: cisErrorLogInfo},
+	{ID: "3.4", Title: "Ensure log files are rotated"},
+	{ID: "3.7", Title: "Ensure proxies pass source IP information", Check: cisProxyRequires("proxy_set_header", "X-Real-IP", "X-Forwarded-For")},
+	{ID: "4.1.1", Title: "Ensure HTTP is redirected to HTTPS", Check: cisHTTPRedirected},
+	{ID: "4.1.2", Title: "Ensure a trusted certificate and trust chain is installed"},
+	{ID: "4.1.3", Title: "Ensure private key permissions are restricted"},
+	{ID: "4.1.4", Title: "Ensure only modern TLS protocols are used", Check: cisModernTLS},
+	{ID: "4.1.5", Title: "Disable weak ciphers"},
+	{ID: "4.1.6", Title: "Ensure custom Diffie-Hellman parameters are used", Check: cisDirectiveSet("ssl_dhparam")},
+	{ID: "4.1.7", Title: "Ensure Online Certificate Status Protocol (OCSP) stapling is enabled", Check: cisOCSPStapling},
+	{ID: "4.1.8", Title: "Ensure HTTP Strict Transport Security (HSTS) is enabled", Check: cisHeaderSet("Strict-Transport-Security")},
+	{ID: "4.1.12", Title: "Ensure session resumption is disabled to enable perfect forward secrecy", Check: cisDirectiveIs("ssl_session_tickets", "off")},
+	{ID: "4.1.13", Title: "Ensure HTTP/2.0 is used", Check: cisHTTP2},
+	{ID: "5.1.1", Title: "Ensure allow and deny filters limit access to specific IP addresses"},
+	{ID: "5.1.2", Title: "Ensure only approved HTTP methods are allowed"},
+	{ID: "5.2.1", Title: "Ensure timeout values for reading the client header and body are set correctly", Check: cisClientTimeouts},
+	{ID: "5.2.2", Title: "Ensure the maximum request body size is set correctly", Check: cisDirectiveSet("client_max_body_size")},
+	{ID: "5.2.3", Title: "Ensure the maximum buffer size for URIs is defined", Check: cisDirectiveSet("large_client_header_buffers")},
+	{ID: "5.2.4", Title: "Ensure the number of connections per IP address is limited", Check: cisDirectiveSet("limit_conn_zone", "limit_conn")},
+	{ID: "5.2.5", Title: "Ensure rate limits by IP address are set", Check: cisDirectiveSet("limit_req_zone", "limit_req")},
+	{ID: "5.3.1", Title: "Ensure X-Frame-Options header is configured and enabled", Check: cisHeaderSet("X-Frame-Options")},
+	{ID: "5.3.2", Title: "Ensure X-Content-Type-Options header is configured and enabled", Check: cisHeaderSet("X-Content-Type-Options")},
+	{ID: "5.3.3", Title: "Ensure that Content Security Policy (CSP) is enabled and configured properly", Check: cisHeaderSet("Content-Security-Policy")},
+	{ID: "5.3.4", Title: "Ensure the Referrer Policy is enabled and configured properly", Check: cisHeaderSet("Referrer-Policy")},
+}
+
+// cisBenchmark Runs the automatable CIS NGINX Benchmark checks against the
+// config and build information of an instance
+func cisBenchmark(resp crossplane.Response, files configFileMap, configArgs []string) CISReport {
+	var report CISReport
+
+	root, _ := combineConfigs(resp, files)
+
+	in := cisInput{
+		Config:     root,
+		ConfigArgs: configArgs,
+	}
+
+	for _, check := range cisChecks {
+		result := CISResult{
+			ID:     check.ID,
+			Title:  check.Title,
+			Status: CISManual,
+		}
+
+		if check.Check != nil {
+			result.Status, result.Detail = check.Check(in)
+		}
+
+		switch result.Status {
+		case CISPass:
+			report.Passed++
+		case CISFail:
+			report.Failed++
+		default:
+			report.Manual++
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// Markdown Renders the report as a Markdown table
+func (r CISReport) Markdown() string {
+	var b strings.Builder
+
+	b.WriteString("# CIS NGINX Benchmark\n\n")
+	b.WriteString(fmt.Sprintf("Passed: %v, Failed: %v, Manual: %v\n\n", r.Passed, r.Failed, r.Manual))
+	b.WriteString("| ID | Recommendation | Status | Detail |\n")
+	b.WriteString("|----|----------------|--------|--------|\n")
+
+	for _, result := range r.Results {
+		b.WriteString(fmt.Sprintf("| %v | %v | %v | %v |\n", result.ID, result.Title, result.Status, strings.ReplaceAll(result.Detail, "|", "\\|")))
+	}
+
+	return b.String()
+}
+
+// hasConfigArg Returns whether the configure arguments include the given
+// argument, ignoring any value
+func hasConfigArg(configArgs []string, arg string) bool {
+	for _, configArg := range configArgs {
+		if configArg == arg || strings.HasPrefix(configArg, arg+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usesTLS Returns whether any server in the config is set up for TLS
+func usesTLS(config crossplane.Directive) bool {
+	if len(config.Descendants("ssl_certificate")) > 0 {
+		return true
+	}
+
+	for _, listen := range config.Descendants("listen") {
+		if hasArg(listen, "ssl") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasArg Returns whether any of the directive's arguments are the given value
+func hasArg(d crossplane.Directive, value string) bool {
+	for _, arg := range d.Args {
+		if arg == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cisModuleNotInstalled(arg string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		if in.ConfigArgs == nil {
+			return CISManual, "configure arguments are not available"
+		}
+
+		if hasConfigArg(in.ConfigArgs, arg) {
+			return CISFail, fmt.Sprintf("nginx was built with %v", arg)
+		}
+
+		return CISPass, ""
+	}
+}
+
+func cisGzipDisabled(in cisInput) (string, string) {
+	for _, arg := range []string{"--with-http_gzip_static_module", "--with-http_gunzip_module"} {
+		if hasConfigArg(in.ConfigArgs, arg) {
+			return CISFail, fmt.Sprintf("nginx was built with %v", arg)
+		}
+	}
+
+	return cisDirectiveNot("gzip", "on")(in)
+}
+
+// cisDirectiveNot Fails if the directive is ever set to the given value
+func cisDirectiveNot(name string, value string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		for _, d := range in.Config.Descendants(name) {
+			if len(d.Args) > 0 && d.Args[0] == value {
+				return CISFail, fmt.Sprintf("%v %v is set", name, value)
+			}
+		}
+
+		return CISPass, ""
+	}
+}
+
+// cisDirectiveIs Passes only if the directive is set, and is always set to the
+// given value
+func cisDirectiveIs(name string, value string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		directives := in.Config.Descendants(name)
+
+		if len(directives) == 0 {
+			return CISFail, fmt.Sprintf("%v is not set", name)
+		}
+
+		for _, d := range directives {
+			if len(d.Args) == 0 || d.Args[0] != value {
+				return CISFail, fmt.Sprintf("%v is set to %v", name, strings.Join(d.Args, " "))
+			}
+		}
+
+		return CISPass, ""
+	}
+}
+
+// cisDirectiveSet Passes if all of the directives are set somewhere in the
+// config
+func cisDirectiveSet(names ...string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		for _, name := range names {
+			if len(in.Config.Descendants(name)) == 0 {
+				return CISFail, fmt.Sprintf("%v is not set", name)
+			}
+		}
+
+		return CISPass, ""
+	}
+}
+
+// cisHeaderSet Passes if the header is added somewhere in the config
+func cisHeaderSet(header string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		for _, d := range in.Config.Descendants("add_header") {
+			if len(d.Args) > 0 && strings.EqualFold(d.Args[0], header) {
+				return CISPass, ""
+			}
+		}
+
+		return CISFail, fmt.Sprintf("%v header is not added", header)
+	}
+}
+
+// cisProxyRequires Passes if the config doesn't proxy requests, or if it does
+// and the directive is used with all of the given headers
+func cisProxyRequires(name string, headers ...string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		if len(in.Config.Descendants("proxy_pass")) == 0 {
+			return CISPass, "proxy_pass is not used"
+		}
+
+		set := make(map[string]bool)
+
+		for _, d := range in.Config.Descendants(name) {
+			if len(d.Args) > 0 {
+				set[strings.ToLower(d.Args[0])] = true
+			}
+		}
+
+		for _, header := range headers {
+			if !set[strings.ToLower(header)] {
+				return CISFail, fmt.Sprintf("%v %v is not set", name, header)
+			}
+		}
+
+		return CISPass, ""
+	}
+}
+
+func cisNonRootUser(in cisInput) (string, string) {
+	users := in.Config.Descendants("user")
+
+	if len(users) == 0 {
+		// The default comes from --user, or nobody
+		for _, arg := range in.ConfigArgs {
+			if strings.HasPrefix(arg, "--user=") && strings.TrimPrefix(arg, "--user=") != "root" {
+				return CISPass, ""
+			}
+		}
+
+		return CISFail, "user is not set"
+	}
+
+	for _, user := range users {
+		if len(user.Args) == 0 || user.Args[0] == "root" {
+			return CISFail, "nginx workers run as root"
+		}
+	}
+
+	return CISPass, ""
+}
+
+var errorStatusRegex = regexp.MustCompile(`^4\d\d$`)
+
+func cisUnknownHostsRejected(in cisInput) (string, string) {
+	for _, server := range in.Config.Descendants("server") {
+		var isDefault bool
+
+		for _, listen := range server.Children("listen") {
+			if hasArg(listen, "default_server") || hasArg(listen, "default") {
+				isDefault = true
+			}
+		}
+
+		if !isDefault {
+			continue
+		}
+
+		for _, ret := range server.Children("return") {
+			if len(ret.Args) > 0 && errorStatusRegex.MatchString(ret.Args[0]) {
+				return CISPass, ""
+			}
+		}
+	}
+
+	return CISFail, "no default_server rejects requests for unknown hosts"
+}
+
+func cisTimeout(name string) func(in cisInput) (string, string) {
+	return func(in cisInput) (string, string) {
+		directives := in.Config.Descendants(name)
+
+		if len(directives) == 0 {
+			return CISFail, fmt.Sprintf("%v is not set, the default is over 10 seconds", name)
+		}
+
+		for _, d := range directives {
+			if len(d.Args) == 0 {
+				continue
+			}
+
+			timeout, err := parseNginxDuration(d.Args[0])
+
+			if err != nil {
+				return CISManual, err.Error()
+			}
+
+			if timeout == 0 || timeout > 10*time.Second {
+				return CISFail, fmt.Sprintf("%v is set to %v", name, d.Args[0])
+			}
+		}
+
+		return CISPass, ""
+	}
+}
+
+func cisClientTimeouts(in cisInput) (string, string) {
+	for _, name := range []string{"client_body_timeout", "client_header_timeout"} {
+		if status, detail := cisTimeout(name)(in); status != CISPass {
+			return status, detail
+		}
+	}
+
+	return CISPass, ""
+}
+
+func cisServerTokensOff(in cisInput) (string, string) {
+	if len(in.Config.Descendants("server_tokens")) == 0 {
+		return CISFail, "server_tokens is not set, the default is on"
+	}
+
+	return cisDirectiveIs("server_tokens", "off")(in)
+}
+
+func cisHiddenFilesDisabled(in cisInput) (string, string) {
+	for _, location := range in.Config.Descendants("location") {
+		if len(location.Args) < 2 || !strings.HasPrefix(location.Args[0], "~") || !strings.Contains(location.Args[1], `/\.`) {
+			continue
+		}
+
+		for _, deny := range location.Children("deny") {
+			if len(deny.Args) > 0 && deny.Args[0] == "all" {
+				return CISPass, ""
+			}
+		}
+
+		for _, ret := range location.Children("return") {
+			if len(ret.Args) > 0 && errorStatusRegex.MatchString(ret.Args[0]) {
+				return CISPass, ""
+			}
+		}
+	}
+
+	return CISFail, "no location denies access to hidden files"
+}
+
+func cisErrorLogInfo(in cisInput) (string, string) {
+	for _, d := range in.Config.Descendants("error_log") {
+		if len(d.Args) > 1 && d.Args[1] == "info" {
+			return CISPass, ""
+		}
+	}
+
+	return CISFail, "error_log is not set to the info level"
+}
+
+func cisHTTPRedirected(in cisInput) (string, string) {
+	if !usesTLS(in.Config) {
+		return CISFail, "TLS is not configured"
+	}
+
+	var detail string
+
+	crossplane.Walk(in.Config.Block, func(server crossplane.Directive, parents []crossplane.Directive) {
+		if detail != "" || !isHTTPServer(server, parents) {
+			return
+		}
+
+		listens := server.Children("listen")
+
+		// Servers without a listen directive accept plain HTTP on port 80
+		plainHTTP := len(listens) == 0
+
+		for _, listen := range listens {
+			if !hasArg(listen, "ssl") && !hasArg(listen, "quic") {
+				plainHTTP = true
+			}
+		}
+
+		if !plainHTTP {
+			return
+		}
+
+		for _, ret := range server.Descendants("return") {
+			if len(ret.Args) > 1 && strings.HasPrefix(ret.Args[1], "https://") {
+				return
+			}
+		}
+
+		detail = fmt.Sprintf("server on line %v accepts plain HTTP without redirecting", server.Line)
+	})
+
+	if detail != "" {
+		return CISFail, detail
+	}
+
+	return CISPass, ""
+}
+
+var modernTLSProtocols = map[string]bool{
+	"TLSv1.2": true,
+	"TLSv1.3": true,
+}
+
+func cisModernTLS(in cisInput) (string, string) {
+	directives := in.Config.Descendants("ssl_protocols")
+
+	if len(directives) == 0 {
+		if !usesTLS(in.Config) {
+			return CISFail, "TLS is not configured"
+		}
+
+		return CISManual, "ssl_protocols is not set, the default depends on the nginx version"
+	}
+
+	for _, d := range directives {
+		for _, protocol := range d.Args {
+			if !modernTLSProtocols[protocol] {
+				return CISFail, fmt.Sprintf("ssl_protocols includes %v", protocol)
+			}
+		}
+	}
+
+	return CISPass, ""
+}
+
+func cisOCSPStapling(in cisInput) (string, string) {
+	for _, name := range []string{"ssl_stapling", "ssl_stapling_verify"} {
+		if status, detail := cisDirectiveIs(name, "on")(in); status != CISPass {
+			return status, detail
+		}
+	}
+
+	return CISPass, ""
+}
+
+func cisHTTP2(in cisInput) (string, string) {
+	for _, d := range in.Config.Descendants("http2") {
+		if len(d.Args) > 0 && d.Args[0] == "on" {
+			return CISPass, ""
+		}
+	}
+
+	for _, listen := range in.Config.Descendants("listen") {
+		if hasArg(listen, "http2") {
+			return CISPass, ""
+		}
+	}
+
+	return CISFail, "HTTP/2 is not enabled"
+}
+
+var durationPartRegex = regexp.MustCompile(`(\d+)(ms|s|m|h|d|w|M|y)?`)
+
+var durationUnits = map[string]time.Duration{
+	"":   time.Second,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"M":  30 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// parseNginxDuration Parses a time in nginx's format e.g. `10s`, `1m30s` or
+// `500ms`. Values without a unit are seconds
+func parseNginxDuration(s string) (time.Duration, error) {
+	var total time.Duration
+
+	remaining := strings.ReplaceAll(s, " ", "")
+
+	if remaining == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	for remaining != "" {
+		loc := durationPartRegex.FindStringSubmatchIndex(remaining)
+
+		if loc == nil || loc[0] != 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		value, err := strconv.Atoi(remaining[loc[2]:loc[3]])
+
+		if err != nil {
+			return 0, err
+		}
+
+		var unit string
+
+		if loc[4] >= 0 {
+			unit = remaining[loc[4]:loc[5]]
+		}
+
+		total += time.Duration(value) * durationUnits[unit]
+		remaining = remaining[loc[1]:]
+	}
+
+	return total, nil
+}
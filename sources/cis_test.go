@@ -0,0 +1,200 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+func TestParseNginxDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"10":    10 * time.Second,
+		"65s":   65 * time.Second,
+		"500ms": 500 * time.Millisecond,
+		"1m30s": 90 * time.Second,
+		"1h 5m": 65 * time.Minute,
+		"2d":    48 * time.Hour,
+	}
+
+	for s, expected := range tests {
+		d, err := parseNginxDuration(s)
+
+		if err != nil {
+			t.Errorf("error parsing %v: %v", s, err)
+		}
+
+		if d != expected {
+			t.Errorf("expected %v to be %v, got %v", s, expected, d)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "10x"} {
+		if _, err := parseNginxDuration(s); err == nil {
+			t.Errorf("expected error parsing %q, got nil", s)
+		}
+	}
+}
+
+func TestCISBenchmark(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/etc/nginx/nginx.conf",
+				Parsed: []crossplane.Directive{
+					{Directive: "user", Args: []string{"www-data"}},
+					{
+						Directive: "http",
+						Block: []crossplane.Directive{
+							{Directive: "server_tokens", Args: []string{"off"}},
+							{Directive: "keepalive_timeout", Args: []string{"65s"}},
+							{Directive: "send_timeout", Args: []string{"10s"}},
+							{Directive: "ssl_protocols", Args: []string{"TLSv1.1", "TLSv1.2"}},
+							{
+								Directive: "server",
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"80", "default_server"}},
+									{Directive: "return", Args: []string{"444"}},
+								},
+							},
+							{
+								Directive: "server",
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"443", "ssl", "http2"}},
+									{Directive: "ssl_certificate", Args: []string{"/etc/ssl/cert.pem"}},
+									{Directive: "add_header", Args: []string{"Strict-Transport-Security", "max-age=31536000"}},
+									{Directive: "location", Args: []string{"/"}, Block: []crossplane.Directive{
+										{Directive: "autoindex", Args: []string{"on"}},
+									}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	report := cisBenchmark(resp, nil, []string{"--prefix=/etc/nginx", "--with-http_dav_module"})
+
+	if len(report.Results) != len(cisChecks) {
+		t.Fatalf("expected %v results, got %v", len(cisChecks), len(report.Results))
+	}
+
+	if total := report.Passed + report.Failed + report.Manual; total != len(cisChecks) {
+		t.Errorf("expected counts to total %v, got %v", len(cisChecks), total)
+	}
+
+	expected := map[string]string{
+		"2.1.2":  CISFail,
+		"2.1.4":  CISFail,
+		"2.2.1":  CISPass,
+		"2.3.2":  CISManual,
+		"2.4.2":  CISPass,
+		"2.4.3":  CISFail,
+		"2.4.4":  CISPass,
+		"2.5.1":  CISPass,
+		"4.1.1":  CISFail,
+		"4.1.4":  CISFail,
+		"4.1.8":  CISPass,
+		"4.1.13": CISPass,
+		"5.3.1":  CISFail,
+	}
+
+	for _, result := range report.Results {
+		if status, ok := expected[result.ID]; ok && result.Status != status {
+			t.Errorf("expected %v (%v) to be %v, got %v: %v", result.ID, result.Title, status, result.Status, result.Detail)
+		}
+	}
+
+	markdown := report.Markdown()
+
+	if !strings.Contains(markdown, "| 2.5.1 | Ensure server_tokens directive is set to `off` | pass |") {
+		t.Errorf("markdown did not contain expected row:\n%v", markdown)
+	}
+
+	// Without configure arguments module checks can't be automated
+	if report := cisBenchmark(resp, nil, nil); report.Results[0].Status != CISManual {
+		t.Errorf("expected 2.1.2 to be manual without configure arguments, got %v", report.Results[0].Status)
+	}
+}
+
+func TestCISHTTPRedirected(t *testing.T) {
+	tlsServer := crossplane.Directive{
+		Directive: "server",
+		Block: []crossplane.Directive{
+			{Directive: "listen", Args: []string{"443", "ssl"}},
+			{Directive: "ssl_certificate", Args: []string{"/etc/ssl/cert.pem"}},
+		},
+	}
+
+	tests := map[string]struct {
+		Server   crossplane.Directive
+		Expected string
+	}{
+		"server without listen": {
+			Server: crossplane.Directive{
+				Directive: "server",
+				Line:      10,
+				Block: []crossplane.Directive{
+					{Directive: "server_name", Args: []string{"example.com"}},
+				},
+			},
+			Expected: CISFail,
+		},
+		"server without listen that redirects": {
+			Server: crossplane.Directive{
+				Directive: "server",
+				Block: []crossplane.Directive{
+					{Directive: "return", Args: []string{"301", "https://$host$request_uri"}},
+				},
+			},
+			Expected: CISPass,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := crossplane.Directive{
+				Block: []crossplane.Directive{
+					{
+						Directive: "http",
+						Block:     []crossplane.Directive{tlsServer, test.Server},
+					},
+					{
+						// Upstream servers aren't server blocks
+						Directive: "upstream",
+						Args:      []string{"backend"},
+						Block: []crossplane.Directive{
+							{Directive: "server", Args: []string{"10.0.0.1:8080"}},
+						},
+					},
+				},
+			}
+
+			if status, detail := cisHTTPRedirected(cisInput{Config: config}); status != test.Expected {
+				t.Errorf("expected %v, got %v: %v", test.Expected, status, detail)
+			}
+		})
+	}
+
+	t.Run("server in a snippet without http", func(t *testing.T) {
+		config := crossplane.Directive{
+			Block: []crossplane.Directive{
+				tlsServer,
+				{
+					Directive: "server",
+					Line:      20,
+					Block: []crossplane.Directive{
+						{Directive: "listen", Args: []string{"80"}},
+					},
+				},
+			},
+		}
+
+		if status, detail := cisHTTPRedirected(cisInput{Config: config}); status != CISFail || detail != "server on line 20 accepts plain HTTP without redirecting" {
+			t.Errorf("expected the plain HTTP server to fail, got %v: %v", status, detail)
+		}
+	})
+}
@@ -0,0 +1,496 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/nginx-source/triggers"
+	"github.com/overmindtech/sdp-go"
+)
+
+// NginxConfigSource Parses nginx config that isn't attached to a running
+// instance, such as config stored in a Kubernetes ConfigMap or config files on
+// a host where nginx isn't running. ConfigMaps are passed in the Search query
+// by triggers, files are read using the `command` source
+type NginxConfigSource struct {
+	Engine *discovery.Engine
+
+	// Optional user-defined rules that each config is checked against
+	Policy *Policy
+
+	// Runs commands in place of the `command` source so that tests don't need
+	// NATS. If this is nil commands are sent using the Engine
+	run func(itemContext string, command string) ([]*sdp.Item, []*sdp.ItemRequestError, error)
+}
+
+// Type The type of items that this source is capable of finding
+func (s *NginxConfigSource) Type() string {
+	return "nginx-config"
+}
+
+// Descriptive name for the source, used in logging and metadata
+func (s *NginxConfigSource) Name() string {
+	return "nginx-config-source"
+}
+
+// List of contexts that this source is capable of find items for
+func (s *NginxConfigSource) Contexts() []string {
+	return []string{
+		sdp.WILDCARD,
+	}
+}
+
+// Get Config items can't be re-collected since the config only exists in the
+// trigger that found it
+func (s *NginxConfigSource) Get(ctx context.Context, itemContext string, query string) (*sdp.Item, error) {
+	return nil, &sdp.ItemRequestError{
+		ErrorType:   sdp.ItemRequestError_NOTFOUND,
+		ErrorString: "nginx-config items can only be found using Search",
+		Context:     itemContext,
+	}
+}
+
+// Find Returns nothing for the same reason as Get
+func (s *NginxConfigSource) Find(ctx context.Context, itemContext string) ([]*sdp.Item, error) {
+	return []*sdp.Item{}, nil
+}
+
+// Search Parses the config in a trigger. The query should be one of the
+// following:
+//
+// * `configmap`: Config files from a Kubernetes ConfigMap, one item is
+// returned per file
+// * `file`: A config file on disk along with the files that it includes
+func (s *NginxConfigSource) Search(ctx context.Context, itemContext string, query string) ([]*sdp.Item, error) {
+	var triggerData triggers.TriggerData
+
+	err := json.Unmarshal([]byte(query), &triggerData)
+
+	if err != nil {
+		return nil, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: err.Error(),
+			Context:     itemContext,
+		}
+	}
+
+	switch triggerData.TriggerType {
+	case triggers.CONFIGMAP:
+		if triggerData.ConfigMapData == nil {
+			return []*sdp.Item{}, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "configmap trigger is missing configmap_data",
+				Context:     itemContext,
+			}
+		}
+
+		keys := make([]string, 0, len(triggerData.ConfigMapData.Files))
+
+		for key := range triggerData.ConfigMapData.Files {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		items := make([]*sdp.Item, 0, len(keys))
+
+		for _, key := range keys {
+			content := triggerData.ConfigMapData.Files[key]
+			config, _, err := parseConfigFile(ctx, key, content)
+
+			if err != nil {
+				return []*sdp.Item{}, &sdp.ItemRequestError{
+					ErrorType:   sdp.ItemRequestError_OTHER,
+					ErrorString: err.Error(),
+					Context:     itemContext,
+				}
+			}
+
+			name := fmt.Sprintf("%v/%v", triggerData.ConfigMapData.Name, key)
+			item, err := s.configItem(itemContext, name, isConfigSnippet(key, content), hashConfig(content), []crossplane.Config{config})
+
+			if err != nil {
+				return []*sdp.Item{}, err
+			}
+
+			if triggerData.TriggerItemRef != nil {
+				item.LinkedItems = append(item.LinkedItems, triggerData.TriggerItemRef)
+			}
+
+			items = append(items, item)
+		}
+
+		return items, nil
+	case triggers.FILE:
+		if triggerData.FileData == nil {
+			return []*sdp.Item{}, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "file trigger is missing file_data",
+				Context:     itemContext,
+			}
+		}
+
+		file := triggerData.FileData.Path
+		configs, contents, snippet, err := s.readConfigFiles(ctx, itemContext, file)
+
+		if err != nil {
+			return []*sdp.Item{}, err
+		}
+
+		item, err := s.configItem(itemContext, file, snippet, hashConfig(contents), configs)
+
+		if err != nil {
+			return []*sdp.Item{}, err
+		}
+
+		if triggerData.TriggerItemRef != nil {
+			item.LinkedItems = append(item.LinkedItems, triggerData.TriggerItemRef)
+		}
+
+		return []*sdp.Item{item}, nil
+	default:
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_NOTFOUND,
+			ErrorString: fmt.Sprintf("query %v not supported", query),
+			Context:     itemContext,
+		}
+	}
+}
+
+// Weight Returns the priority weighting of items returned by this source
+func (s *NginxConfigSource) Weight() int {
+	return 100
+}
+
+// parseConfigFile Parses the contents of a single config file without
+// following its includes. The blocks that the file is included from aren't
+// known, so each of the contexts that files are commonly included in is tried
+// and the first that parses without errors is used, see configContexts. The
+// context is returned so that the files it includes can be parsed within it
+func parseConfigFile(ctx context.Context, file string, content string) (crossplane.Config, []crossplane.Directive, error) {
+	var best crossplane.Config
+	var bestContext []crossplane.Directive
+
+	for i, parents := range configContexts(file, content) {
+		config, err := parseConfigFileIn(ctx, file, content, parents)
+
+		if err != nil {
+			return crossplane.Config{}, nil, err
+		}
+
+		if i == 0 || len(config.Errors) < len(best.Errors) {
+			best = config
+			bestContext = parents
+		}
+
+		if len(config.Errors) == 0 {
+			break
+		}
+	}
+
+	return best, bestContext, nil
+}
+
+// parseConfigFileIn Parses the contents of a single config file within the
+// blocks that it is included from, so that its directives aren't rejected
+// for being in the wrong context. The blocks are opened on the first line so
+// that line numbers don't change, and are removed again after parsing
+func parseConfigFileIn(ctx context.Context, file string, content string, parents []crossplane.Directive) (crossplane.Config, error) {
+	text := content
+
+	if len(parents) > 0 {
+		open, close := contextWrapper(parents)
+		text = open + " " + content + "\n" + close
+	}
+
+	resp, err := crossplane.ParseSingle(ctx, text)
+
+	if err != nil {
+		return crossplane.Config{}, fmt.Errorf("error parsing %v: %v", file, err)
+	}
+
+	config := crossplane.Config{
+		File:   file,
+		Status: resp.Status,
+	}
+
+	if len(resp.Config) > 0 {
+		config.Parsed = unwrapContext(resp.Config[0].Parsed, parents)
+	}
+
+	// crossplane reports the temporary file that it parsed
+	for _, e := range resp.Errors {
+		e.File = file
+		config.Errors = append(config.Errors, e)
+	}
+
+	return config, nil
+}
+
+// configItem Returns an `nginx-config` item for a config file along with any
+// files that it includes, which come after it
+func (s *NginxConfigSource) configItem(itemContext string, name string, snippet bool, hash string, configs []crossplane.Config) (*sdp.Item, error) {
+	resp := crossplane.Response{
+		Status: "ok",
+		Config: configs,
+	}
+
+	files := make([]string, len(configs))
+
+	for i, config := range configs {
+		files[i] = config.File
+		resp.Errors = append(resp.Errors, config.Errors...)
+	}
+
+	if len(resp.Errors) > 0 {
+		resp.Status = "failed"
+	}
+
+	attrMap := map[string]interface{}{
+		"name":       name,
+		"file":       files[0],
+		"files":      files,
+		"snippet":    snippet,
+		"configHash": hash,
+	}
+
+	if len(resp.Errors) > 0 {
+		var messages []ConfigTestMessage
+
+		for _, e := range resp.Errors {
+			messages = append(messages, ConfigTestMessage{
+				Level:   "emerg",
+				Message: e.Error,
+				File:    e.File,
+				Line:    e.Line,
+			})
+		}
+
+		attrMap["configStatus"] = "invalid"
+		attrMap["configErrors"] = messages
+	} else {
+		attrMap["configStatus"] = "valid"
+		attrMap["config"] = resp.Config
+		attrMap["lintFindings"] = lintConfig(resp, nil)
+
+		if s.Policy != nil {
+			attrMap["policyViolations"] = s.Policy.evaluate(resp, nil)
+		}
+	}
+
+	attributes, err := sdp.ToAttributes(attrMap)
+
+	if err != nil {
+		return nil, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: fmt.Sprintf("error converting to attributes: %v", err),
+			Context:     itemContext,
+		}
+	}
+
+	return &sdp.Item{
+		Type:            "nginx-config",
+		UniqueAttribute: "name",
+		Attributes:      attributes,
+		Context:         itemContext,
+	}, nil
+}
+
+var mainContextRegex = regexp.MustCompile(`(?m)^\s*(http|events|stream|mail)\s*\{`)
+
+// configContexts Returns the blocks that a file might be included from, most
+// likely first. `nginx.conf` and files with top level blocks are main config
+// files. Anything else is a snippet, which is most often included in the http
+// block e.g. `conf.d/default.conf`, but can also be included in a server or
+// location e.g. `snippets/fastcgi-php.conf`, or the main context e.g.
+// `modules-enabled/*.conf`
+func configContexts(file string, content string) [][]crossplane.Directive {
+	if !isConfigSnippet(file, content) {
+		return [][]crossplane.Directive{nil}
+	}
+
+	http := crossplane.Directive{Directive: "http"}
+	server := crossplane.Directive{Directive: "server"}
+	location := crossplane.Directive{Directive: "location", Args: []string{"/"}}
+
+	return [][]crossplane.Directive{
+		{http},
+		nil,
+		{http, server},
+		{http, server, location},
+	}
+}
+
+// isConfigSnippet Returns whether a file is a snippet that is included from
+// another file rather than a main config file. Anything other than
+// `nginx.conf` without a top level block is treated as a snippet
+func isConfigSnippet(file string, content string) bool {
+	return path.Base(file) != "nginx.conf" && !mainContextRegex.MatchString(content)
+}
+
+// unwrapContext Removes the blocks that a file was wrapped in so that the
+// config matches the file
+func unwrapContext(parsed []crossplane.Directive, parents []crossplane.Directive) []crossplane.Directive {
+	for _, p := range parents {
+		if len(parsed) != 1 || parsed[0].Directive != p.Directive {
+			break
+		}
+
+		parsed = parsed[0].Block
+	}
+
+	return parsed
+}
+
+// maxConfigFiles The most files that are read when following includes, in
+// case of include loops or very large configs
+const maxConfigFiles = 100
+
+// readConfigFiles Reads a config file and the files that it includes, which
+// is the same set of files that `nginx -T` would print. Relative includes are
+// resolved against the directory of the file, or `/etc/nginx` for files
+// within it since that is where packaged configs expect to be loaded from.
+// Files that can't be read are reported as errors in the config rather than
+// failing the whole search. Included files are parsed within the blocks that
+// they are included from. The contents of every file are returned for hashing
+func (s *NginxConfigSource) readConfigFiles(ctx context.Context, itemContext string, file string) ([]crossplane.Config, string, bool, error) {
+	resolver := pathResolver{ConfPrefix: path.Dir(file)}
+
+	if strings.HasPrefix(file, "/etc/nginx/") {
+		resolver.ConfPrefix = "/etc/nginx"
+	}
+
+	var configs []crossplane.Config
+	var contents strings.Builder
+	var snippet bool
+
+	// The blocks that each file is included from. Files that are included
+	// more than once are parsed in the context of the first include
+	contexts := map[string][]crossplane.Directive{}
+	queue := []string{file}
+	seen := map[string]bool{file: true}
+
+	for len(queue) > 0 && len(configs) < maxConfigFiles {
+		f := queue[0]
+		queue = queue[1:]
+
+		content, collectionErr := s.commandStdout(itemContext, fmt.Sprintf("cat %v", shellQuote(f)))
+
+		if collectionErr != nil {
+			if f == file {
+				errorType := sdp.ItemRequestError_OTHER
+
+				if collectionErr.Type == CollectionErrorNotFound {
+					errorType = sdp.ItemRequestError_NOTFOUND
+				}
+
+				return nil, "", false, &sdp.ItemRequestError{
+					ErrorType:   errorType,
+					ErrorString: collectionErr.Error,
+					Context:     itemContext,
+				}
+			}
+
+			configs = append(configs, crossplane.Config{
+				File:   f,
+				Status: "failed",
+				Errors: []crossplane.Error{{File: f, Error: collectionErr.Error}},
+			})
+
+			continue
+		}
+
+		var config crossplane.Config
+		var err error
+
+		if f == file {
+			snippet = isConfigSnippet(f, content)
+			config, contexts[f], err = parseConfigFile(ctx, f, content)
+		} else {
+			config, err = parseConfigFileIn(ctx, f, content, contexts[f])
+		}
+
+		if err != nil {
+			return nil, "", false, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: err.Error(),
+				Context:     itemContext,
+			}
+		}
+
+		// Use the same markers as `nginx -T` so that the hash changes if
+		// files are moved
+		fmt.Fprintf(&contents, "# configuration file %v:\n%v\n", f, content)
+		configs = append(configs, config)
+
+		crossplane.Walk(config.Parsed, func(d crossplane.Directive, parents []crossplane.Directive) {
+			if d.Directive != "include" || len(d.Args) == 0 {
+				return
+			}
+
+			for _, included := range s.expandInclude(itemContext, resolver.Resolve(d.Args[0], true)) {
+				if !seen[included] {
+					seen[included] = true
+					contexts[included] = append(append([]crossplane.Directive{}, contexts[f]...), parents...)
+					queue = append(queue, included)
+				}
+			}
+		})
+	}
+
+	return configs, contents.String(), snippet, nil
+}
+
+// expandInclude Returns the files that an include refers to. Patterns such as
+// `conf.d/*.conf` are expanded using `find` rather than relying on the
+// `command` source to expand wildcards. Only the file name can contain
+// wildcards
+func (s *NginxConfigSource) expandInclude(itemContext string, pattern string) []string {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}
+	}
+
+	dir, name := path.Split(pattern)
+	command := fmt.Sprintf("find %v -maxdepth 1 -name %v -type f", shellQuote(path.Clean(dir)), shellQuote(name))
+	output, collectionErr := s.commandStdout(itemContext, command)
+
+	if collectionErr != nil {
+		return nil
+	}
+
+	var files []string
+
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+
+	// nginx includes matching files in alphabetical order
+	sort.Strings(files)
+
+	return files
+}
+
+// runCommand Runs a command using the `command` source in the given context
+func (s *NginxConfigSource) runCommand(itemContext string, command string) ([]*sdp.Item, []*sdp.ItemRequestError, error) {
+	if s.run != nil {
+		return s.run(itemContext, command)
+	}
+
+	return runCommand(s.Engine, itemContext, command)
+}
+
+// commandStdout Runs a command and returns its stdout
+func (s *NginxConfigSource) commandStdout(itemContext string, command string) (string, *CollectionError) {
+	items, errs, err := s.runCommand(itemContext, command)
+
+	return singleStdout(command, items, errs, err)
+}
@@ -0,0 +1,238 @@
+package sources
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestIsConfigSnippet(t *testing.T) {
+	tests := []struct {
+		File    string
+		Content string
+		Snippet bool
+	}{
+		{"nginx.conf", "user nginx;\n", false},
+		{"main.conf", "events {}\nhttp {\n    server {}\n}\n", false},
+		{"default.conf", "server {\n    listen 80;\n}\n", true},
+		{"upstreams.conf", "upstream app {\n    server 10.0.0.1;\n}\n", true},
+	}
+
+	for _, test := range tests {
+		if snippet := isConfigSnippet(test.File, test.Content); snippet != test.Snippet {
+			t.Errorf("expected %v to be a snippet: %v, got %v", test.File, test.Snippet, snippet)
+		}
+	}
+}
+
+func TestUnwrapContext(t *testing.T) {
+	http := crossplane.Directive{Directive: "http"}
+	server := crossplane.Directive{Directive: "server"}
+
+	parsed := []crossplane.Directive{
+		{
+			Directive: "http",
+			Line:      1,
+			Block: []crossplane.Directive{
+				{
+					Directive: "server",
+					Line:      1,
+					Block: []crossplane.Directive{
+						{Directive: "try_files", Line: 1},
+						{Directive: "fastcgi_pass", Line: 2},
+					},
+				},
+			},
+		},
+	}
+
+	if unwrapped := unwrapContext(parsed, []crossplane.Directive{http, server}); len(unwrapped) != 2 || unwrapped[0].Directive != "try_files" {
+		t.Errorf("expected the http and server blocks to be removed, got %v", unwrapped)
+	}
+
+	if unwrapped := unwrapContext(parsed, nil); len(unwrapped) != 1 || unwrapped[0].Directive != "http" {
+		t.Errorf("expected main config to be unchanged, got %v", unwrapped)
+	}
+}
+
+func TestConfigContexts(t *testing.T) {
+	if contexts := configContexts("nginx.conf", "user nginx;\n"); len(contexts) != 1 || contexts[0] != nil {
+		t.Errorf("expected nginx.conf to only be parsed in the main context, got %v", contexts)
+	}
+
+	// Snippets are most often included in the http block
+	if contexts := configContexts("default.conf", "server {}\n"); len(contexts) != 4 || len(contexts[0]) != 1 || contexts[0][0].Directive != "http" {
+		t.Errorf("expected the http block to be tried first, got %v", contexts)
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		File      string
+		Content   string
+		Directive string
+		Context   int
+	}{
+		{"default.conf", "server {\n    listen 80;\n}\n", "server", 1},
+		{"50-mod-http-geoip.conf", "load_module modules/ngx_http_geoip_module.so;\n", "load_module", 0},
+		{"fastcgi-php.conf", "try_files $fastcgi_script_name =404;\nfastcgi_pass unix:/run/php/php-fpm.sock;\n", "try_files", 3},
+	}
+
+	for _, test := range tests {
+		config, parents, err := parseConfigFile(context.Background(), test.File, test.Content)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(config.Errors) != 0 {
+			t.Errorf("expected %v to parse without errors, got %+v", test.File, config.Errors)
+		}
+
+		if len(config.Parsed) == 0 || config.Parsed[0].Directive != test.Directive || config.Parsed[0].Line != 1 {
+			t.Errorf("expected %v to start with %v on line 1, got %+v", test.File, test.Directive, config.Parsed)
+		}
+
+		if len(parents) != test.Context {
+			t.Errorf("expected %v to be parsed in %v blocks, got %v", test.File, test.Context, parents)
+		}
+	}
+}
+
+func TestNginxConfigSource(t *testing.T) {
+	tests := []SourceTest{
+		{
+			Name:        "get isn't supported",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_GET,
+			Query:       "nginx/nginx.conf",
+			ExpectedError: &ExpectedError{
+				Type:    sdp.ItemRequestError_NOTFOUND,
+				Context: "test",
+			},
+		},
+		{
+			Name:        "with an invalid query",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "nginx.conf",
+			ExpectedError: &ExpectedError{
+				Type:    sdp.ItemRequestError_OTHER,
+				Context: "test",
+			},
+		},
+		{
+			Name:        "with a file trigger without a path",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       `{"trigger_type":5}`,
+			ExpectedError: &ExpectedError{
+				Type:    sdp.ItemRequestError_OTHER,
+				Context: "test",
+			},
+		},
+		{
+			Name:        "with an unsupported trigger",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       `{"trigger_type":0}`,
+			ExpectedError: &ExpectedError{
+				Type:    sdp.ItemRequestError_NOTFOUND,
+				Context: "test",
+			},
+		},
+	}
+
+	RunSourceTests(t, tests, &NginxConfigSource{})
+}
+
+func TestExpandInclude(t *testing.T) {
+	var s NginxConfigSource
+
+	// Paths without wildcards don't need to be looked up
+	if files := s.expandInclude("test", "/etc/nginx/mime.types"); len(files) != 1 || files[0] != "/etc/nginx/mime.types" {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestReadConfigFiles(t *testing.T) {
+	commands := TestNginxCommandSource{
+		Outputs: map[string]string{
+			`^cat /etc/nginx/nginx.conf$`:                             "include /etc/nginx/modules-enabled/*.conf;\nevents {}\nhttp {\n    include conf.d/*.conf;\n}\ninclude missing.conf;\n",
+			`^find /etc/nginx/modules-enabled -maxdepth 1 -name `:     "/etc/nginx/modules-enabled/50-mod-http-geoip.conf\n",
+			`^find /etc/nginx/conf.d -maxdepth 1 -name `:              "/etc/nginx/conf.d/upstreams.conf\n/etc/nginx/conf.d/default.conf\n",
+			`^cat /etc/nginx/modules-enabled/50-mod-http-geoip.conf$`: "load_module modules/ngx_http_geoip_module.so;\n",
+			`^cat /etc/nginx/conf.d/default.conf$`:                    "server {\n    listen 80;\n\n    location ~ \\.php$ {\n        include snippets/fastcgi-php.conf;\n    }\n}\n",
+			`^cat /etc/nginx/conf.d/upstreams.conf$`:                  "upstream app {\n    server 10.0.0.1;\n}\n",
+			`^cat /etc/nginx/snippets/fastcgi-php.conf$`:              "try_files $fastcgi_script_name =404;\nfastcgi_pass unix:/run/php/php-fpm.sock;\n",
+		},
+		Failures: map[string]string{
+			`^cat /etc/nginx/missing.conf$`: "cat: /etc/nginx/missing.conf: No such file or directory\n",
+			`^cat /etc/nginx/gone.conf$`:    "cat: /etc/nginx/gone.conf: No such file or directory\n",
+		},
+	}
+
+	s := NginxConfigSource{run: commands.Run}
+	configs, contents, snippet, err := s.readConfigFiles(context.Background(), "test", "/etc/nginx/nginx.conf")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snippet {
+		t.Error("expected nginx.conf not to be a snippet")
+	}
+
+	// Globs are expanded in alphabetical order and nested includes are
+	// followed after the files that include them
+	expected := []string{
+		"/etc/nginx/nginx.conf",
+		"/etc/nginx/modules-enabled/50-mod-http-geoip.conf",
+		"/etc/nginx/conf.d/default.conf",
+		"/etc/nginx/conf.d/upstreams.conf",
+		"/etc/nginx/missing.conf",
+		"/etc/nginx/snippets/fastcgi-php.conf",
+	}
+
+	if len(configs) != len(expected) {
+		t.Fatalf("expected %v files, got %+v", len(expected), configs)
+	}
+
+	for i, file := range expected {
+		if configs[i].File != file {
+			t.Errorf("expected file %v to be %v, got %v", i, file, configs[i].File)
+		}
+	}
+
+	// Included files are parsed in the blocks that they are included from
+	for i, config := range configs {
+		if i != 4 && len(config.Errors) != 0 {
+			t.Errorf("expected %v to parse without errors, got %+v", config.File, config.Errors)
+		}
+	}
+
+	if modules := configs[1].Parsed; len(modules) != 1 || modules[0].Directive != "load_module" {
+		t.Errorf("expected the module to be loaded, got %+v", modules)
+	}
+
+	if snippet := configs[5].Parsed; len(snippet) != 2 || snippet[1].Directive != "fastcgi_pass" || snippet[1].Line != 2 {
+		t.Errorf("expected the snippet to be parsed within the location, got %+v", snippet)
+	}
+
+	if missing := configs[4]; missing.Status != "failed" || len(missing.Errors) != 1 || !strings.Contains(missing.Errors[0].Error, "exit code 1") {
+		t.Errorf("expected the missing file to be reported as an error, got %+v", missing)
+	}
+
+	if !strings.Contains(contents, "# configuration file /etc/nginx/snippets/fastcgi-php.conf:\n") {
+		t.Errorf("expected the contents of the nested include, got %v", contents)
+	}
+
+	t.Run("when the file can't be read", func(t *testing.T) {
+		if _, _, _, err := s.readConfigFiles(context.Background(), "test", "/etc/nginx/gone.conf"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package sources
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ConfigTest The result of testing the config on disk with `nginx -t`. This
+// can differ from the running config if files have changed since the last
+// reload
+type ConfigTest struct {
+	// Whether the config passed the test. A service with an invalid config on
+	// disk will fail to start or reload
+	Valid bool
+
+	ExitCode int
+
+	// Warnings and errors reported by the test
+	Messages []ConfigTestMessage
+}
+
+// ConfigTestMessage A single message from `nginx -t` e.g. `nginx: [warn]
+// conflicting server name "example.com" on 0.0.0.0:80, ignored`
+type ConfigTestMessage struct {
+	// The log level e.g. `warn` or `emerg`
+	Level   string
+	Message string
+
+	// The file and line that the message refers to, if given
+	File string
+	Line int
+}
+
+var configTestMessageRegex = regexp.MustCompile(`^nginx: \[(\w+)\] (.*?)(?: in (\S+):(\d+))?$`)
+
+// parseConfigTest Parses the exit code and stderr of `nginx -t`. This is also
+// used for `nginx -T` which reports errors in the same way
+func parseConfigTest(exitCode int, stderr string) ConfigTest {
+	result := ConfigTest{
+		ExitCode: exitCode,
+		Valid:    exitCode == 0 && !strings.Contains(stderr, "test failed"),
+	}
+
+	for _, line := range strings.Split(stderr, "\n") {
+		matches := configTestMessageRegex.FindStringSubmatch(strings.TrimSpace(line))
+
+		if len(matches) != 5 {
+			continue
+		}
+
+		message := ConfigTestMessage{
+			Level:   matches[1],
+			Message: matches[2],
+			File:    matches[3],
+		}
+
+		if matches[4] != "" {
+			message.Line, _ = strconv.Atoi(matches[4])
+		}
+
+		result.Messages = append(result.Messages, message)
+	}
+
+	// If nginx couldn't be run at all the error won't be in nginx's format
+	// e.g. `sh: nginx: not found`, keep it rather than losing the reason
+	if !result.Valid && len(result.Messages) == 0 && strings.TrimSpace(stderr) != "" {
+		result.Messages = append(result.Messages, ConfigTestMessage{
+			Level:   "error",
+			Message: strings.TrimSpace(stderr),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,58 @@
+package sources
+
+import (
+	"testing"
+)
+
+func TestParseConfigTest(t *testing.T) {
+	t.Run("with warnings", func(t *testing.T) {
+		result := parseConfigTest(0, `nginx: [warn] conflicting server name "example.com" on 0.0.0.0:80, ignored
+nginx: [warn] duplicate MIME type "text/html" in /etc/nginx/conf.d/default.conf:12
+nginx: [warn] protocol options redefined for 0.0.0.0:443 in /etc/nginx/sites-enabled/app:3
+nginx: the configuration file /etc/nginx/nginx.conf syntax is ok
+nginx: configuration file /etc/nginx/nginx.conf test is successful
+`)
+
+		if !result.Valid {
+			t.Error("expected config to be valid")
+		}
+
+		expected := []ConfigTestMessage{
+			{Level: "warn", Message: `conflicting server name "example.com" on 0.0.0.0:80, ignored`},
+			{Level: "warn", Message: `duplicate MIME type "text/html"`, File: "/etc/nginx/conf.d/default.conf", Line: 12},
+			{Level: "warn", Message: "protocol options redefined for 0.0.0.0:443", File: "/etc/nginx/sites-enabled/app", Line: 3},
+		}
+
+		if len(result.Messages) != len(expected) {
+			t.Fatalf("expected %v messages, got %v", len(expected), result.Messages)
+		}
+
+		for i := range expected {
+			if result.Messages[i] != expected[i] {
+				t.Errorf("expected %+v, got %+v", expected[i], result.Messages[i])
+			}
+		}
+	})
+
+	t.Run("with an invalid config", func(t *testing.T) {
+		result := parseConfigTest(1, `nginx: [emerg] unknown directive "sever" in /etc/nginx/conf.d/default.conf:1
+nginx: configuration file /etc/nginx/nginx.conf test failed
+`)
+
+		if result.Valid {
+			t.Error("expected config to be invalid")
+		}
+
+		if len(result.Messages) != 1 || result.Messages[0].Level != "emerg" || result.Messages[0].Line != 1 {
+			t.Errorf("unexpected messages %+v", result.Messages)
+		}
+	})
+
+	t.Run("when nginx can't be run", func(t *testing.T) {
+		result := parseConfigTest(127, "sh: 1: nginx: not found\n")
+
+		if result.Valid || len(result.Messages) != 1 || result.Messages[0].Message != "sh: 1: nginx: not found" {
+			t.Errorf("unexpected result %+v", result)
+		}
+	})
+}
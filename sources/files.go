@@ -0,0 +1,346 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// configFile The location of a single file within the output of `nginx -T`
+type configFile struct {
+	// The path to the file on disk
+	Path string
+
+	// The line in the output containing the `# configuration file` marker. The
+	// first line of the file's content is the line after this
+	MarkerLine int
+}
+
+// configFileMap The files that make up the output of `nginx -T`, in the order
+// that they appear
+type configFileMap []configFile
+
+var configFileRegex = regexp.MustCompile(`^# configuration file (.*):$`)
+
+// splitConfigFiles Finds the `# configuration file` markers that `nginx -T`
+// inserts before the content of each file
+func splitConfigFiles(output string) configFileMap {
+	var files configFileMap
+
+	for i, line := range strings.Split(output, "\n") {
+		if matches := configFileRegex.FindStringSubmatch(line); len(matches) == 2 {
+			files = append(files, configFile{
+				Path:       matches[1],
+				MarkerLine: i + 1,
+			})
+		}
+	}
+
+	return files
+}
+
+// Locate Converts a line number in the `nginx -T` output to the file and line
+// within that file. If the output didn't contain any markers the line is
+// returned as-is with an empty path
+func (m configFileMap) Locate(line int) (string, int) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if line > m[i].MarkerLine {
+			return m[i].Path, line - m[i].MarkerLine
+		}
+	}
+
+	return "", line
+}
+
+// parseConfigOutput Parses the output of `nginx -T` into a single config,
+// with the directives of each included file added after the `include` that
+// includes them. The output can't be parsed as a single file since included
+// files would end up at the top level, e.g. the `server` blocks from
+// `conf.d/*.conf` would be outside of `http`. Instead each file is parsed in
+// the blocks that it is included from, see contextWrapper. Files are parsed a
+// level of includes at a time so that crossplane is only run once per level.
+// Directives keep the line numbers that they have in the output so that they
+// can be located using the file map
+func parseConfigOutput(ctx context.Context, output string, files configFileMap) (crossplane.Response, error) {
+	if len(files) == 0 {
+		return crossplane.ParseSingle(ctx, output)
+	}
+
+	lines := strings.Split(output, "\n")
+	confPrefix := path.Dir(files[0].Path)
+	contexts := map[int][]crossplane.Directive{0: nil}
+	parsed := make(map[int][]crossplane.Directive)
+	resp := crossplane.Response{Status: "ok"}
+	level := []int{0}
+
+	for len(level) > 0 {
+		levelResp, err := crossplane.ParseSingle(ctx, files.levelText(lines, level, contexts))
+
+		if err != nil {
+			return crossplane.Response{}, err
+		}
+
+		var top []crossplane.Directive
+
+		if len(levelResp.Config) > 0 {
+			top = levelResp.Config[0].Parsed
+		}
+
+		// crossplane reports the temporary file that it parsed
+		for _, e := range levelResp.Errors {
+			file, line := files.Locate(e.Line)
+			e.Error = strings.ReplaceAll(e.Error, fmt.Sprintf("%v:%v", e.File, e.Line), fmt.Sprintf("%v:%v", file, line))
+			e.File = file
+			e.Line = line
+
+			resp.Errors = append(resp.Errors, e)
+		}
+
+		var next []int
+
+		for _, i := range level {
+			parsed[i] = files.fileDirectives(top, i, len(contexts[i]))
+
+			crossplane.Walk(parsed[i], func(d crossplane.Directive, parents []crossplane.Directive) {
+				if d.Directive != "include" || len(d.Args) == 0 {
+					return
+				}
+
+				for _, j := range files.Included(confPrefix, d.Args[0]) {
+					if _, ok := contexts[j]; !ok {
+						contexts[j] = append(append([]crossplane.Directive{}, contexts[i]...), parents...)
+						next = append(next, j)
+					}
+				}
+			})
+		}
+
+		level = next
+	}
+
+	config := crossplane.Config{
+		File:   files[0].Path,
+		Status: "ok",
+		Errors: resp.Errors,
+		Parsed: files.graftIncludes(parsed[0], parsed, confPrefix, map[int]bool{0: true}),
+	}
+
+	if len(resp.Errors) > 0 {
+		config.Status = "failed"
+		resp.Status = "failed"
+	}
+
+	resp.Config = []crossplane.Config{config}
+
+	return resp, nil
+}
+
+// levelText Returns the output with only the given files left in, each
+// wrapped in the blocks that it is included from. The wrapper is opened on
+// the file's marker line and closed on the line after the file, and the rest
+// of the output is blanked, so that every directive keeps the line number
+// that it has in the output
+func (m configFileMap) levelText(lines []string, level []int, contexts map[int][]crossplane.Directive) string {
+	text := make([]string, len(lines)+1)
+	opens := make([]string, len(lines)+1)
+	closes := make([]string, len(lines)+1)
+
+	for _, i := range level {
+		start, end := m.contentLines(i, len(lines))
+		opens[start-1], closes[end] = contextWrapper(contexts[i])
+
+		copy(text[start:end], lines[start:end])
+	}
+
+	for i := range text {
+		if opens[i] != "" || closes[i] != "" {
+			text[i] = strings.TrimSpace(closes[i] + " " + opens[i])
+		}
+	}
+
+	return strings.Join(text, "\n")
+}
+
+// contentLines Returns the range of indexes in the output's lines that hold
+// the content of a file. The marker comes just before the start
+func (m configFileMap) contentLines(i int, numLines int) (int, int) {
+	start := m[i].MarkerLine
+	end := numLines
+
+	if i+1 < len(m) {
+		end = m[i+1].MarkerLine - 1
+	}
+
+	return start, end
+}
+
+// fileDirectives Returns the directives of a file from the parsed text of
+// its level, removing the blocks that it was wrapped in
+func (m configFileMap) fileDirectives(top []crossplane.Directive, i int, depth int) []crossplane.Directive {
+	marker := m[i].MarkerLine
+	var directives []crossplane.Directive
+
+	for _, d := range top {
+		if depth == 0 {
+			if d.Line > marker && (i+1 == len(m) || d.Line < m[i+1].MarkerLine) {
+				directives = append(directives, d)
+			}
+
+			continue
+		}
+
+		if d.Line != marker {
+			continue
+		}
+
+		block := d.Block
+
+		for level := 1; level < depth && len(block) > 0 && block[0].Line == marker; level++ {
+			block = block[0].Block
+		}
+
+		return block
+	}
+
+	return directives
+}
+
+// contextWrapper Returns the text that opens and closes the blocks that an
+// include is in, so that the included file can be parsed without context
+// errors e.g. `http { server {` and `} }`. Arguments are quoted since
+// crossplane has already removed any quotes from them
+func contextWrapper(parents []crossplane.Directive) (string, string) {
+	var opens []string
+	var closes []string
+
+	for _, p := range parents {
+		words := []string{p.Directive}
+
+		for _, arg := range p.Args {
+			words = append(words, `"`+configArgEscaper.Replace(arg)+`"`)
+		}
+
+		opens = append(opens, strings.Join(words, " ")+" {")
+		closes = append(closes, "}")
+	}
+
+	return strings.Join(opens, " "), strings.Join(closes, " ")
+}
+
+var configArgEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Included Returns the indexes of the files that an include refers to, in the
+// order that nginx includes them. Relative paths are relative to the
+// directory of the main config file, which is the first file
+func (m configFileMap) Included(confPrefix string, pattern string) []int {
+	if !path.IsAbs(pattern) {
+		pattern = path.Join(confPrefix, pattern)
+	}
+
+	var included []int
+
+	for i, f := range m {
+		if matched, err := path.Match(pattern, f.Path); err == nil && matched {
+			included = append(included, i)
+		}
+	}
+
+	return included
+}
+
+// graftIncludes Returns the directives with the directives of each included
+// file added after the include that includes them. nginx only prints each
+// file once, so files that are included more than once are added at each
+// include. Files that are already being included are skipped to avoid loops
+func (m configFileMap) graftIncludes(directives []crossplane.Directive, parsed map[int][]crossplane.Directive, confPrefix string, including map[int]bool) []crossplane.Directive {
+	grafted := make([]crossplane.Directive, 0, len(directives))
+
+	for _, d := range directives {
+		if len(d.Block) > 0 {
+			d.Block = m.graftIncludes(d.Block, parsed, confPrefix, including)
+		}
+
+		grafted = append(grafted, d)
+
+		if d.Directive != "include" || len(d.Args) == 0 {
+			continue
+		}
+
+		for _, j := range m.Included(confPrefix, d.Args[0]) {
+			if including[j] {
+				continue
+			}
+
+			including[j] = true
+			grafted = append(grafted, m.graftIncludes(parsed[j], parsed, confPrefix, including)...)
+			delete(including, j)
+		}
+	}
+
+	return grafted
+}
+
+// combineConfigs Returns the parsed config as a single block along with the
+// map needed to locate its directives. When parsing `nginx -T` output the
+// first config already contains every file, see parseConfigOutput. Otherwise
+// the line numbers of each file are offset so that they don't overlap
+func combineConfigs(resp crossplane.Response, files configFileMap) (crossplane.Directive, configFileMap) {
+	root := crossplane.Directive{}
+
+	if len(resp.Config) == 0 {
+		return root, files
+	}
+
+	if len(files) > 0 {
+		root.Block = resp.Config[0].Parsed
+
+		return root, files
+	}
+
+	var offset int
+
+	for _, config := range resp.Config {
+		files = append(files, configFile{
+			Path:       config.File,
+			MarkerLine: offset,
+		})
+
+		root.Block = append(root.Block, offsetLines(config.Parsed, offset)...)
+
+		offset += maxLine(config.Parsed)
+	}
+
+	return root, files
+}
+
+// offsetLines Returns a copy of the directives with the offset added to all
+// line numbers
+func offsetLines(directives []crossplane.Directive, offset int) []crossplane.Directive {
+	offsetDirectives := make([]crossplane.Directive, len(directives))
+
+	for i, d := range directives {
+		d.Line += offset
+		d.Block = offsetLines(d.Block, offset)
+
+		offsetDirectives[i] = d
+	}
+
+	return offsetDirectives
+}
+
+// maxLine Returns the highest line number of any of the directives
+func maxLine(directives []crossplane.Directive) int {
+	var max int
+
+	crossplane.Walk(directives, func(d crossplane.Directive, parents []crossplane.Directive) {
+		if d.Line > max {
+			max = d.Line
+		}
+	})
+
+	return max
+}
@@ -0,0 +1,189 @@
+package sources
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// testConfigOutput The output of `nginx -T` for a Debian style layout, where
+// servers and modules are in included files
+const testConfigOutput = `# configuration file /etc/nginx/nginx.conf:
+user www-data;
+include /etc/nginx/modules-enabled/*.conf;
+
+events {
+    worker_connections 768;
+}
+
+http {
+    add_header X-Frame-Options DENY;
+    include mime.types;
+    include /etc/nginx/conf.d/*.conf;
+    include /etc/nginx/sites-enabled/*;
+}
+
+# configuration file /etc/nginx/modules-enabled/50-mod-http-geoip.conf:
+load_module modules/ngx_http_geoip_module.so;
+
+# configuration file /etc/nginx/mime.types:
+types {
+    text/html html htm shtml;
+}
+
+# configuration file /etc/nginx/sites-enabled/default:
+server {
+    listen 80 default_server;
+    server_name _;
+
+    location ~ \.php$ {
+        include snippets/fastcgi-php.conf;
+    }
+}
+
+# configuration file /etc/nginx/snippets/fastcgi-php.conf:
+try_files $fastcgi_script_name =404;
+fastcgi_pass unix:/run/php/php-fpm.sock;
+
+`
+
+func TestParseConfigOutput(t *testing.T) {
+	files := splitConfigFiles(testConfigOutput)
+	resp, err := parseConfigOutput(context.Background(), testConfigOutput, files)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Errors) != 0 {
+		t.Errorf("expected no errors, got %+v", resp.Errors)
+	}
+
+	root, files := combineConfigs(resp, files)
+
+	if modules := root.Children("load_module"); len(modules) != 1 {
+		t.Errorf("expected the module to be loaded in the main context, got %+v", modules)
+	}
+
+	http := root.Children("http")
+
+	if len(http) != 1 {
+		t.Fatalf("expected 1 http block, got %+v", http)
+	}
+
+	servers := http[0].Children("server")
+
+	if len(servers) != 1 {
+		t.Fatalf("expected the included server to be within http, got %+v", http[0].Block)
+	}
+
+	if file, line := files.Locate(servers[0].Line); file != "/etc/nginx/sites-enabled/default" || line != 1 {
+		t.Errorf("expected the server to be located in its file, got %v:%v", file, line)
+	}
+
+	locations := servers[0].Children("location")
+
+	if len(locations) != 1 || len(locations[0].Children("fastcgi_pass")) != 1 {
+		t.Errorf("expected the snippet to be included in the location, got %+v", locations)
+	}
+
+	if listed := listServers(resp, files, "nginx", false, ""); len(listed) != 1 || listed[0].File != "/etc/nginx/sites-enabled/default" {
+		t.Errorf("expected the included server to be listed, got %+v", listed)
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	files := splitConfigFiles(testConfigOutput)
+	lines := strings.Split(testConfigOutput, "\n")
+	server := crossplane.Directive{Directive: "server"}
+	location := crossplane.Directive{Directive: "location", Args: []string{"~", `\.php$`}}
+
+	contexts := map[int][]crossplane.Directive{
+		3: {{Directive: "http"}},
+		4: {{Directive: "http"}, server, location},
+	}
+
+	textLines := strings.Split(files.levelText(lines, []int{3, 4}, contexts), "\n")
+
+	if len(textLines) != len(lines)+1 {
+		t.Fatalf("expected %v lines, got %v", len(lines)+1, len(textLines))
+	}
+
+	// Every line keeps its number, with the wrappers on the marker lines
+	for i, expected := range map[int]string{
+		files[3].MarkerLine - 1: "http {",
+		files[3].MarkerLine:     "server {",
+		files[4].MarkerLine - 1: `} http { server { location "~" "\\.php$" {`,
+		files[4].MarkerLine:     "try_files $fastcgi_script_name =404;",
+		len(lines):              "} } }",
+		1:                       "",
+	} {
+		if textLines[i] != expected {
+			t.Errorf("expected line %v to be %q, got %q", i+1, expected, textLines[i])
+		}
+	}
+}
+
+func TestIncluded(t *testing.T) {
+	files := splitConfigFiles(testConfigOutput)
+
+	tests := map[string][]int{
+		"/etc/nginx/modules-enabled/*.conf": {1},
+		"mime.types":                        {2},
+		"/etc/nginx/sites-enabled/*":        {3},
+		"snippets/fastcgi-php.conf":         {4},
+		"/etc/nginx/conf.d/*.conf":          nil,
+	}
+
+	for pattern, expected := range tests {
+		included := files.Included("/etc/nginx", pattern)
+
+		if len(included) != len(expected) || (len(expected) > 0 && included[0] != expected[0]) {
+			t.Errorf("expected %v to include %v, got %v", pattern, expected, included)
+		}
+	}
+}
+
+func TestGraftIncludes(t *testing.T) {
+	files := configFileMap{
+		{Path: "/etc/nginx/nginx.conf", MarkerLine: 1},
+		{Path: "/etc/nginx/snippets/headers.conf", MarkerLine: 10},
+		{Path: "/etc/nginx/snippets/loop.conf", MarkerLine: 20},
+	}
+
+	parsed := map[int][]crossplane.Directive{
+		0: {
+			{Directive: "http", Line: 2, Block: []crossplane.Directive{
+				{Directive: "server", Line: 3, Block: []crossplane.Directive{
+					{Directive: "include", Line: 4, Args: []string{"snippets/headers.conf"}},
+				}},
+				{Directive: "server", Line: 5, Block: []crossplane.Directive{
+					{Directive: "include", Line: 6, Args: []string{"snippets/headers.conf"}},
+				}},
+			}},
+		},
+		1: {
+			{Directive: "add_header", Line: 11, Args: []string{"X-Frame-Options", "DENY"}},
+			{Directive: "include", Line: 12, Args: []string{"snippets/loop.conf"}},
+		},
+		2: {
+			{Directive: "include", Line: 21, Args: []string{"snippets/headers.conf"}},
+		},
+	}
+
+	grafted := files.graftIncludes(parsed[0], parsed, "/etc/nginx", map[int]bool{0: true})
+	servers := grafted[0].Children("server")
+
+	// Files that are included more than once are added at each include
+	for _, server := range servers {
+		if headers := server.Children("add_header"); len(headers) != 1 || headers[0].Line != 11 {
+			t.Errorf("expected the snippet to be grafted into the server, got %+v", server.Block)
+		}
+
+		if includes := server.Children("include"); len(includes) != 3 {
+			t.Errorf("expected the loop to stop after one level, got %+v", server.Block)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package sources
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/sdp-go"
+)
+
+// IngressBackend The Kubernetes objects that an ingress-nginx location was
+// generated from
+type IngressBackend struct {
+	Namespace   string
+	Ingress     string
+	Service     string
+	ServicePort string
+	Path        string
+
+	// The SDP context of the Kubernetes objects
+	Context string
+}
+
+// ingressServerRegex ingress-nginx surrounds each server in the generated
+// config with `## start server example.com` and `## end server example.com`
+var ingressServerRegex = regexp.MustCompile(`(?m)^\s*## start server \S+`)
+
+// isIngressNginx Returns whether the output of `nginx -T` was generated by
+// the ingress-nginx controller. The markers are comments so this has to be
+// checked before the config is parsed
+func isIngressNginx(output string) bool {
+	return ingressServerRegex.MatchString(output)
+}
+
+// parseIngressBackend Reads the variables that ingress-nginx sets in each
+// location to record where it came from e.g. `set $ingress_name "web";`.
+// Locations that weren't generated from an Ingress, such as the default
+// backend, return nil
+func parseIngressBackend(location crossplane.Directive, cluster string) *IngressBackend {
+	variables := make(map[string]string)
+
+	for _, set := range location.Children("set") {
+		if len(set.Args) == 2 {
+			variables[set.Args[0]] = strings.Trim(set.Args[1], `"`)
+		}
+	}
+
+	backend := IngressBackend{
+		Namespace:   variables["$namespace"],
+		Ingress:     variables["$ingress_name"],
+		Service:     variables["$service_name"],
+		ServicePort: variables["$service_port"],
+		Path:        variables["$location_path"],
+	}
+
+	if backend.Namespace == "" || backend.Ingress == "" || backend.Ingress == "-" {
+		return nil
+	}
+
+	backend.Context = kubernetesContext(cluster, backend.Namespace)
+
+	return &backend
+}
+
+// kubernetesContext Returns the SDP context for a namespace, which is
+// prefixed by the cluster name if it is known
+func kubernetesContext(cluster string, namespace string) string {
+	if cluster == "" {
+		return namespace
+	}
+
+	return fmt.Sprintf("%v.%v", cluster, namespace)
+}
+
+// Links Returns the requests that link to the Ingress and Service
+func (b IngressBackend) Links() []*sdp.ItemRequest {
+	links := []*sdp.ItemRequest{
+		{
+			Type:    "ingress",
+			Method:  sdp.RequestMethod_GET,
+			Query:   b.Ingress,
+			Context: b.Context,
+		},
+	}
+
+	if b.Service != "" && b.Service != "-" {
+		links = append(links, &sdp.ItemRequest{
+			Type:    "service",
+			Method:  sdp.RequestMethod_GET,
+			Query:   b.Service,
+			Context: b.Context,
+		})
+	}
+
+	return links
+}
@@ -0,0 +1,70 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+func TestIsIngressNginx(t *testing.T) {
+	if !isIngressNginx("http {\n\t## start server example.com\n\tserver {\n\t}\n\t## end server example.com\n}\n") {
+		t.Error("expected ingress-nginx config to be recognised")
+	}
+
+	if isIngressNginx("http {\n\tserver {\n\t}\n}\n") {
+		t.Error("expected plain config not to be recognised")
+	}
+}
+
+func TestParseIngressBackend(t *testing.T) {
+	location := crossplane.Directive{
+		Directive: "location",
+		Args:      []string{"/api/"},
+		Block: []crossplane.Directive{
+			{Directive: "set", Args: []string{"$namespace", "shop"}},
+			{Directive: "set", Args: []string{"$ingress_name", "web"}},
+			{Directive: "set", Args: []string{"$service_name", "api"}},
+			{Directive: "set", Args: []string{"$service_port", "8080"}},
+			{Directive: "set", Args: []string{"$location_path", "/api"}},
+		},
+	}
+
+	backend := parseIngressBackend(location, "prod")
+
+	if backend == nil {
+		t.Fatal("expected a backend")
+	}
+
+	expected := IngressBackend{
+		Namespace:   "shop",
+		Ingress:     "web",
+		Service:     "api",
+		ServicePort: "8080",
+		Path:        "/api",
+		Context:     "prod.shop",
+	}
+
+	if *backend != expected {
+		t.Errorf("expected %+v, got %+v", expected, *backend)
+	}
+
+	links := backend.Links()
+
+	if len(links) != 2 || links[0].Type != "ingress" || links[0].Query != "web" || links[1].Type != "service" || links[1].Context != "prod.shop" {
+		t.Errorf("unexpected links %v", links)
+	}
+
+	// The default backend isn't generated from an Ingress
+	defaultBackend := crossplane.Directive{
+		Directive: "location",
+		Args:      []string{"/"},
+		Block: []crossplane.Directive{
+			{Directive: "set", Args: []string{"$namespace", ""}},
+			{Directive: "set", Args: []string{"$ingress_name", ""}},
+		},
+	}
+
+	if backend := parseIngressBackend(defaultBackend, ""); backend != nil {
+		t.Errorf("expected no backend, got %+v", backend)
+	}
+}
@@ -0,0 +1,324 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// NginxArgs The command line arguments that affect which config an nginx
+// instance runs with
+type NginxArgs struct {
+	// The config file, from `-c`
+	ConfFile string
+
+	// The prefix path, from `-p`
+	Prefix string
+
+	// Global directives, from `-g`
+	Globals string
+
+	// The error log file, from `-e`
+	ErrorLog string
+}
+
+// NginxInstance An nginx binary and the arguments it was started with. All
+// commands that are run against the instance should be built using Command so
+// that they see the same config as the running process
+type NginxInstance struct {
+	Binary string
+	Args   NginxArgs
+
+	// The ID of the container that nginx runs in, if any. Commands are run
+	// inside the container using `docker exec`
+	Container string
+}
+
+// parseNginxArgs Parses command line arguments such as those from a service's
+// `ExecStart`. nginx accepts values both as a separate argument (`-c
+// /etc/nginx/nginx.conf`) and attached to the flag (`-c/etc/nginx/nginx.conf`).
+// Flags that don't affect the config such as `-s` or `-q` are ignored
+func parseNginxArgs(args []string) NginxArgs {
+	var nginxArgs NginxArgs
+
+	fields := map[string]*string{
+		"-c": &nginxArgs.ConfFile,
+		"-p": &nginxArgs.Prefix,
+		"-g": &nginxArgs.Globals,
+		"-e": &nginxArgs.ErrorLog,
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+
+		flag := arg[:2]
+		value := arg[2:]
+
+		if flag == "-s" {
+			// Takes a value but it's the signal, skip it
+			if value == "" {
+				i++
+			}
+
+			continue
+		}
+
+		field, ok := fields[flag]
+
+		if !ok {
+			continue
+		}
+
+		if value == "" && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+
+		*field = value
+	}
+
+	return nginxArgs
+}
+
+// Command Returns a shell command that runs nginx with the given flags
+// followed by the instance's arguments e.g. `nginx -V -c /opt/app/nginx.conf`
+func (i NginxInstance) Command(flags ...string) string {
+	binary := i.Binary
+
+	if binary == "" {
+		binary = "nginx"
+	}
+
+	parts := append([]string{shellQuote(binary)}, flags...)
+
+	for _, arg := range []struct {
+		Flag  string
+		Value string
+	}{
+		{"-p", i.Args.Prefix},
+		{"-c", i.Args.ConfFile},
+		{"-e", i.Args.ErrorLog},
+		{"-g", i.Args.Globals},
+	} {
+		if arg.Value != "" {
+			parts = append(parts, arg.Flag, shellQuote(arg.Value))
+		}
+	}
+
+	return i.Exec(strings.Join(parts, " "))
+}
+
+// Exec Returns a shell command that runs the given command wherever the
+// instance runs. For instances in a container this is prefixed with `docker
+// exec` so the command must be a simple command without pipes or
+// substitutions
+func (i NginxInstance) Exec(command string) string {
+	if i.Container == "" {
+		return command
+	}
+
+	return fmt.Sprintf("%v %v %v", dockerExecPrefix, shellQuote(i.Container), command)
+}
+
+// dockerExecPrefix The command used to run commands inside a container
+const dockerExecPrefix = "docker exec"
+
+// ID Returns a stable identifier for the instance made up of the binary, the
+// prefix and the config file, in the form of a command line e.g.
+// `/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf`. Paths that
+// weren't given as arguments are taken from the build profile from `nginx
+// -V`, so the same nginx has the same ID whether it was found from a service
+// that only gives the binary, a package that gives the config file or a
+// process that was started with `-g`. `-g` and `-e` are left out since they
+// don't change which nginx it is. Unlike the config hash this doesn't change
+// when the config is edited. Instances in a container are prefixed with
+// `docker exec` and the container ID
+func (i NginxInstance) ID(profile NginxBuildProfile) string {
+	prefix := i.Args.Prefix
+
+	if prefix == "" {
+		prefix = profile.Prefix
+	}
+
+	confFile := i.Args.ConfFile
+
+	if confFile == "" {
+		confFile = profile.ConfPath
+	}
+
+	binary := cleanPath(i.Binary)
+
+	if !path.IsAbs(binary) && profile.SbinPath != "" {
+		binary = joinPrefix(prefix, profile.SbinPath)
+	}
+
+	identity := NginxInstance{
+		Binary:    binary,
+		Container: i.Container,
+		Args: NginxArgs{
+			Prefix:   cleanPath(prefix),
+			ConfFile: joinPrefix(prefix, confFile),
+		},
+	}
+
+	return identity.Command()
+}
+
+// joinPrefix Returns a path that is relative to the prefix as an absolute
+// path, in the same way as nginx does. Paths are left unchanged if they are
+// already absolute or the prefix isn't known
+func joinPrefix(prefix string, p string) string {
+	if p == "" || path.IsAbs(p) || prefix == "" {
+		return cleanPath(p)
+	}
+
+	return path.Join(prefix, p)
+}
+
+// cleanPath Removes trailing slashes and other redundant elements from a path
+// so that equivalent paths are the same, leaving empty paths empty
+func cleanPath(p string) string {
+	if p == "" {
+		return ""
+	}
+
+	return path.Clean(p)
+}
+
+// parseInstanceID Parses an identifier returned by ID back into the instance
+func parseInstanceID(id string) (NginxInstance, error) {
+	words, err := shellSplit(id)
+
+	if err != nil {
+		return NginxInstance{}, fmt.Errorf("invalid instance %q: %v", id, err)
+	}
+
+	var container string
+
+	if len(words) >= 2 && strings.Join(words[:2], " ") == dockerExecPrefix {
+		if len(words) < 3 {
+			return NginxInstance{}, fmt.Errorf("invalid instance %q: expected a container ID", id)
+		}
+
+		container = words[2]
+		words = words[3:]
+	}
+
+	if len(words) == 0 || strings.HasPrefix(words[0], "-") {
+		return NginxInstance{}, fmt.Errorf("invalid instance %q: expected the path to the nginx binary followed by its arguments", id)
+	}
+
+	return NginxInstance{
+		Binary:    words[0],
+		Args:      parseNginxArgs(words[1:]),
+		Container: container,
+	}, nil
+}
+
+// shellSplit Splits a command line into words, the reverse of quoting each
+// word with shellQuote. Only single quotes and backslash escapes are
+// supported
+func shellSplit(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+
+	inWord := false
+	inQuote := false
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case inQuote && r == '\'':
+			inQuote = false
+		case inQuote:
+			word.WriteRune(r)
+		case r == '\'':
+			inQuote = true
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if inQuote || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+var shellSafeRegex = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote Quotes a value so that it is passed as a single argument when
+// run by a shell
+func shellQuote(s string) string {
+	if shellSafeRegex.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseGlobals Parses the directives passed with `-g` e.g. `daemon off;
+// worker_processes 2;`. These can only be simple directives in the main
+// context
+func parseGlobals(globals string) []crossplane.Directive {
+	var directives []crossplane.Directive
+
+	for _, statement := range strings.Split(globals, ";") {
+		fields := strings.Fields(statement)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		d := crossplane.Directive{
+			Directive: fields[0],
+		}
+
+		for _, arg := range fields[1:] {
+			d.Args = append(d.Args, strings.Trim(arg, `'"`))
+		}
+
+		directives = append(directives, d)
+	}
+
+	return directives
+}
+
+// mergeGlobals Adds the directives from `-g` to the start of the main
+// config. They have no line number since they don't come from a file
+func mergeGlobals(resp *crossplane.Response, globals string) {
+	directives := parseGlobals(globals)
+
+	if len(directives) == 0 || len(resp.Config) == 0 {
+		return
+	}
+
+	resp.Config[0].Parsed = append(directives, resp.Config[0].Parsed...)
+}
@@ -0,0 +1,198 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+func TestParseNginxArgs(t *testing.T) {
+	args := parseNginxArgs([]string{
+		"-p", "/srv/nginx",
+		"-c/opt/app/nginx.conf",
+		"-g", "daemon on; master_process on;",
+		"-e", "stderr",
+		"-q",
+		"-s", "reload",
+	})
+
+	tests := map[string][2]string{
+		"ConfFile": {args.ConfFile, "/opt/app/nginx.conf"},
+		"Prefix":   {args.Prefix, "/srv/nginx"},
+		"Globals":  {args.Globals, "daemon on; master_process on;"},
+		"ErrorLog": {args.ErrorLog, "stderr"},
+	}
+
+	for field, values := range tests {
+		if values[0] != values[1] {
+			t.Errorf("expected %v to be %v, got %v", field, values[1], values[0])
+		}
+	}
+}
+
+func TestInstanceCommand(t *testing.T) {
+	t.Run("with no args", func(t *testing.T) {
+		instance := NginxInstance{Binary: "/usr/sbin/nginx"}
+
+		if cmd := instance.Command("-V"); cmd != "/usr/sbin/nginx -V" {
+			t.Errorf("unexpected command %v", cmd)
+		}
+	})
+
+	t.Run("with args", func(t *testing.T) {
+		instance := NginxInstance{
+			Args: NginxArgs{
+				ConfFile: "/opt/app/nginx.conf",
+				Prefix:   "/srv/nginx",
+				Globals:  "daemon on; pid '/run/nginx.pid';",
+			},
+		}
+
+		expected := `nginx -Tq -p /srv/nginx -c /opt/app/nginx.conf -g 'daemon on; pid '\''/run/nginx.pid'\'';'`
+
+		if cmd := instance.Command("-Tq"); cmd != expected {
+			t.Errorf("expected command %v, got %v", expected, cmd)
+		}
+	})
+}
+
+func TestInstanceExec(t *testing.T) {
+	if cmd := (NginxInstance{}).Exec("date +%s"); cmd != "date +%s" {
+		t.Errorf("expected commands to run on the host, got %v", cmd)
+	}
+
+	instance := NginxInstance{Container: "4f66ad9a0b2e"}
+
+	if cmd := instance.Exec("date +%s"); cmd != "docker exec 4f66ad9a0b2e date +%s" {
+		t.Errorf("unexpected command %v", cmd)
+	}
+
+	if cmd := instance.Command("-V"); cmd != "docker exec 4f66ad9a0b2e nginx -V" {
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
+
+func TestMergeGlobals(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				Parsed: []crossplane.Directive{
+					{Directive: "user", Args: []string{"nginx"}, Line: 1},
+				},
+			},
+		},
+	}
+
+	mergeGlobals(&resp, "daemon on; worker_processes 2;")
+
+	parsed := resp.Config[0].Parsed
+
+	if len(parsed) != 3 {
+		t.Fatalf("expected 3 directives, got %v", parsed)
+	}
+
+	if parsed[0].Directive != "daemon" || parsed[0].Args[0] != "on" {
+		t.Errorf("unexpected first directive %v", parsed[0])
+	}
+
+	if parsed[1].Directive != "worker_processes" || parsed[1].Args[0] != "2" {
+		t.Errorf("unexpected second directive %v", parsed[1])
+	}
+
+	if parsed[2].Directive != "user" {
+		t.Errorf("expected the config's own directives to follow, got %v", parsed[2])
+	}
+}
+
+func TestInstanceID(t *testing.T) {
+	instance := NginxInstance{
+		Binary: "/opt/my nginx/sbin/nginx",
+		Args: NginxArgs{
+			Prefix:   "/opt/my nginx/",
+			ConfFile: "conf/it's.conf",
+			ErrorLog: "stderr",
+			Globals:  "daemon off; include /etc/nginx/extra.conf;",
+		},
+	}
+
+	id := instance.ID(NginxBuildProfile{})
+
+	if id != `'/opt/my nginx/sbin/nginx' -p '/opt/my nginx' -c '/opt/my nginx/conf/it'\''s.conf'` {
+		t.Errorf("unexpected id %v", id)
+	}
+
+	parsed, err := parseInstanceID(id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NginxInstance{
+		Binary: "/opt/my nginx/sbin/nginx",
+		Args: NginxArgs{
+			Prefix:   "/opt/my nginx",
+			ConfFile: "/opt/my nginx/conf/it's.conf",
+		},
+	}
+
+	if parsed != expected {
+		t.Errorf("expected the id to parse back to %+v, got %+v", expected, parsed)
+	}
+
+	// Globals and the error log don't change which nginx it is
+	other := instance
+	other.Args.Globals = "daemon off;"
+	other.Args.ErrorLog = ""
+
+	if other.ID(NginxBuildProfile{}) != id {
+		t.Errorf("expected instances that only differ by -g and -e to have the same id, got %v", other.ID(NginxBuildProfile{}))
+	}
+
+	container := NginxInstance{Container: "4f66ad9a0b2e"}
+	id = container.ID(NginxBuildProfile{Prefix: "/etc/nginx", SbinPath: "/usr/sbin/nginx", ConfPath: "/etc/nginx/nginx.conf"})
+
+	if id != "docker exec 4f66ad9a0b2e /usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf" {
+		t.Errorf("unexpected container id %v", id)
+	}
+
+	if parsed, err := parseInstanceID(id); err != nil || parsed.Container != container.Container || parsed.Binary != "/usr/sbin/nginx" {
+		t.Errorf("expected the container id to parse back to the instance, got %+v, %v", parsed, err)
+	}
+
+	for _, invalid := range []string{"", "-c /etc/nginx/nginx.conf", "'/usr/sbin/nginx", "docker exec", "docker exec 4f66ad9a0b2e"} {
+		if _, err := parseInstanceID(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestInstanceIDAcrossTriggers(t *testing.T) {
+	profile := parseBuildProfile([]string{
+		"--prefix=/etc/nginx",
+		"--sbin-path=/usr/sbin/nginx",
+		"--conf-path=/etc/nginx/nginx.conf",
+	})
+
+	// The same nginx as seen by the service, package and process triggers
+	instances := map[string]NginxInstance{
+		"service": {
+			Binary: "/usr/sbin/nginx",
+		},
+		"package": {
+			Binary: "/usr/sbin/nginx",
+			Args:   NginxArgs{ConfFile: "/etc/nginx/nginx.conf"},
+		},
+		"process": {
+			Binary: "/usr/sbin/nginx",
+			Args:   parseNginxArgs([]string{"-g", "daemon off;"}),
+		},
+	}
+
+	expected := "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf"
+
+	for trigger, instance := range instances {
+		if id := instance.ID(profile); id != expected {
+			t.Errorf("expected the %v instance to have the id %v, got %v", trigger, expected, id)
+		}
+	}
+}
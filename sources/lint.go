@@ -0,0 +1,296 @@
+package sources
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// LintFinding A potential security issue found in the config
+type LintFinding struct {
+	// The name of the check that found the issue
+	Check string
+
+	// One of: high, medium, low
+	Severity string
+
+	Message string
+	File    string
+	Line    int
+}
+
+// lintCheck A single check that is run against every directive in the config.
+// If the directive has a problem the check returns a message describing it
+type lintCheck struct {
+	Name     string
+	Severity string
+	Check    func(d crossplane.Directive, parents []crossplane.Directive) (string, bool)
+}
+
+var lintChecks = []lintCheck{
+	{
+		Name:     "alias_traversal",
+		Severity: "high",
+		Check:    checkAliasTraversal,
+	},
+	{
+		Name:     "add_header_redefinition",
+		Severity: "medium",
+		Check:    checkAddHeaderRedefinition,
+	},
+	{
+		Name:     "host_spoofing",
+		Severity: "medium",
+		Check:    checkHostSpoofing,
+	},
+	{
+		Name:     "ssrf",
+		Severity: "high",
+		Check:    checkSSRF,
+	},
+	{
+		Name:     "origin_regex",
+		Severity: "medium",
+		Check:    checkOriginRegex,
+	},
+	{
+		Name:     "http_splitting",
+		Severity: "high",
+		Check:    checkHTTPSplitting,
+	},
+	{
+		Name:     "server_tokens",
+		Severity: "low",
+		Check:    checkServerTokens,
+	},
+}
+
+// lintConfig Runs all checks against the parsed config. The file map is used
+// to convert line numbers in the `nginx -T` output back to the original files
+func lintConfig(resp crossplane.Response, files configFileMap) []LintFinding {
+	var findings []LintFinding
+
+	root, files := combineConfigs(resp, files)
+
+	crossplane.Walk(root.Block, func(d crossplane.Directive, parents []crossplane.Directive) {
+		for _, check := range lintChecks {
+			if message, found := check.Check(d, parents); found {
+				file, line := files.Locate(d.Line)
+
+				findings = append(findings, LintFinding{
+					Check:    check.Name,
+					Severity: check.Severity,
+					Message:  message,
+					File:     file,
+					Line:     line,
+				})
+			}
+		}
+	})
+
+	return findings
+}
+
+// parentDirective Returns the directive that directly encloses this one, or
+// an empty directive if it is at the top level
+func parentDirective(parents []crossplane.Directive) crossplane.Directive {
+	if len(parents) == 0 {
+		return crossplane.Directive{}
+	}
+
+	return parents[len(parents)-1]
+}
+
+// checkAliasTraversal Finds prefix locations without a trailing slash that
+// use an alias with one e.g. `location /i { alias /data/w3/images/; }` which
+// allows `/i../` to read the parent directory
+func checkAliasTraversal(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	location := parentDirective(parents)
+
+	if d.Directive != "alias" || len(d.Args) == 0 || location.Directive != "location" || len(location.Args) == 0 {
+		return "", false
+	}
+
+	// Regex locations don't have this problem
+	if len(location.Args) > 1 && location.Args[0] != "^~" {
+		return "", false
+	}
+
+	path := location.Args[len(location.Args)-1]
+
+	if !strings.HasSuffix(path, "/") && strings.HasSuffix(d.Args[0], "/") {
+		return fmt.Sprintf("location %v uses alias %v which allows path traversal to the parent directory via %v../", path, d.Args[0], path), true
+	}
+
+	return "", false
+}
+
+// checkAddHeaderRedefinition Finds blocks that use add_header when an
+// enclosing block also does. add_header is only inherited if the current
+// block doesn't set any headers itself, so any outer headers that the block
+// doesn't set again are silently dropped
+func checkAddHeaderRedefinition(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	headers := d.Children("add_header")
+
+	if len(headers) == 0 {
+		return "", false
+	}
+
+	set := make(map[string]bool)
+
+	for _, h := range headers {
+		if len(h.Args) > 0 {
+			set[strings.ToLower(h.Args[0])] = true
+		}
+	}
+
+	for i := len(parents) - 1; i >= 0; i-- {
+		parentHeaders := parents[i].Children("add_header")
+
+		if len(parentHeaders) == 0 {
+			continue
+		}
+
+		var dropped []string
+
+		for _, h := range parentHeaders {
+			if len(h.Args) > 0 && !set[strings.ToLower(h.Args[0])] {
+				dropped = append(dropped, h.Args[0])
+			}
+		}
+
+		if len(dropped) == 0 {
+			return "", false
+		}
+
+		return fmt.Sprintf("add_header in %v block drops the headers set in the enclosing %v block: %v", d.Directive, parents[i].Directive, strings.Join(dropped, ", ")), true
+	}
+
+	return "", false
+}
+
+// checkHostSpoofing Finds redirects that build the URL using $http_host,
+// which is taken straight from the client's Host header
+func checkHostSpoofing(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	if d.Directive != "return" && d.Directive != "rewrite" {
+		return "", false
+	}
+
+	for _, arg := range d.Args {
+		if strings.Contains(arg, "$http_host") {
+			return fmt.Sprintf("%v uses $http_host which can be spoofed by the client, use $host instead", d.Directive), true
+		}
+	}
+
+	return "", false
+}
+
+var proxySchemeRegex = regexp.MustCompile(`^[a-z]+://`)
+
+// checkSSRF Finds proxy_pass directives where the host is taken from a
+// variable, which could allow requests to be proxied to arbitrary servers.
+// Variables after a fixed host e.g. `http://backend$request_uri` only change
+// the path so are fine
+func checkSSRF(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	if d.Directive != "proxy_pass" || len(d.Args) == 0 {
+		return "", false
+	}
+
+	host := proxySchemeRegex.ReplaceAllString(d.Args[0], "")
+
+	if strings.HasPrefix(host, "$") {
+		return fmt.Sprintf("proxy_pass %v takes the upstream host from a variable", d.Args[0]), true
+	}
+
+	return "", false
+}
+
+var originVariables = map[string]bool{
+	"$http_origin":  true,
+	"$http_referer": true,
+}
+
+// checkOriginRegex Finds regexes used to validate the Origin or Referer
+// headers that can be bypassed by using a different domain
+func checkOriginRegex(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	var patterns []string
+
+	switch d.Directive {
+	case "valid_referers":
+		for _, arg := range d.Args {
+			if strings.HasPrefix(arg, "~") {
+				patterns = append(patterns, arg)
+			}
+		}
+	default:
+		// Map keys are parsed as directives in a map block
+		if parent := parentDirective(parents); parent.Directive == "map" && len(parent.Args) > 0 && originVariables[parent.Args[0]] && strings.HasPrefix(d.Directive, "~") {
+			patterns = append(patterns, d.Directive)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if reason := weakOriginRegex(pattern); reason != "" {
+			return fmt.Sprintf("regex %v %v", pattern, reason), true
+		}
+	}
+
+	return "", false
+}
+
+var unescapedDotRegex = regexp.MustCompile(`(^|[^\\])\.[^*+?]`)
+
+// weakOriginRegex Returns the reason that an origin regex could be bypassed,
+// or an empty string if it looks safe
+func weakOriginRegex(pattern string) string {
+	pattern = strings.TrimLeft(pattern, "~*")
+
+	if !strings.HasSuffix(pattern, "$") {
+		return "is not anchored with $ so also matches other domains that start with the allowed one"
+	}
+
+	if unescapedDotRegex.MatchString(pattern) {
+		return "contains an unescaped . which matches any character"
+	}
+
+	return ""
+}
+
+var uriVariableRegex = regexp.MustCompile(`\$(\{)?(uri|document_uri)\b`)
+
+var httpSplittingDirectives = map[string]bool{
+	"return":           true,
+	"rewrite":          true,
+	"add_header":       true,
+	"proxy_set_header": true,
+	"proxy_pass":       true,
+}
+
+// checkHTTPSplitting Finds directives that write $uri into a response or
+// upstream request. $uri is decoded so can contain CRLF which allows the
+// client to inject headers
+func checkHTTPSplitting(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	if !httpSplittingDirectives[d.Directive] {
+		return "", false
+	}
+
+	for _, arg := range d.Args {
+		if uriVariableRegex.MatchString(arg) {
+			return fmt.Sprintf("%v uses the decoded $uri which allows CRLF injection, use $request_uri instead", d.Directive), true
+		}
+	}
+
+	return "", false
+}
+
+// checkServerTokens Finds configs that include the nginx version in error
+// pages and the Server header
+func checkServerTokens(d crossplane.Directive, parents []crossplane.Directive) (string, bool) {
+	if d.Directive == "server_tokens" && len(d.Args) > 0 && d.Args[0] == "on" {
+		return "server_tokens on discloses the nginx version", true
+	}
+
+	return "", false
+}
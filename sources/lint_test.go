@@ -0,0 +1,176 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+func TestLintConfig(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/tmp/crossplane123",
+				Parsed: []crossplane.Directive{
+					{Directive: "server_tokens", Args: []string{"on"}, Line: 2},
+					{
+						Directive: "server",
+						Line:      5,
+						Block: []crossplane.Directive{
+							{Directive: "add_header", Args: []string{"X-Frame-Options", "DENY"}, Line: 6},
+							{Directive: "return", Args: []string{"301", "https://$http_host$request_uri"}, Line: 7},
+							{
+								Directive: "location",
+								Args:      []string{"/static"},
+								Line:      8,
+								Block: []crossplane.Directive{
+									{Directive: "alias", Args: []string{"/var/www/static/"}, Line: 9},
+									{Directive: "add_header", Args: []string{"Cache-Control", "public"}, Line: 10},
+								},
+							},
+							{
+								Directive: "location",
+								Args:      []string{"~", `\.php$`},
+								Line:      12,
+								Block: []crossplane.Directive{
+									{Directive: "alias", Args: []string{"/var/www/php/"}, Line: 13},
+									{Directive: "proxy_pass", Args: []string{"http://$arg_host/api"}, Line: 14},
+								},
+							},
+							{
+								Directive: "location",
+								Args:      []string{"/ok/"},
+								Line:      16,
+								Block: []crossplane.Directive{
+									{Directive: "alias", Args: []string{"/var/www/ok/"}, Line: 17},
+									{Directive: "proxy_pass", Args: []string{"http://backend$request_uri"}, Line: 18},
+									{Directive: "return", Args: []string{"302", "https://example.com$uri"}, Line: 19},
+								},
+							},
+						},
+					},
+					{
+						Directive: "map",
+						Args:      []string{"$http_origin", "$cors"},
+						Line:      22,
+						Block: []crossplane.Directive{
+							{Directive: `~^https://example.com`, Args: []string{"1"}, Line: 23},
+							{Directive: `~^https://example\.org$`, Args: []string{"1"}, Line: 24},
+						},
+					},
+					{Directive: "valid_referers", Args: []string{"none", `~\.example.com$`}, Line: 26},
+				},
+			},
+		},
+	}
+
+	files := configFileMap{
+		{Path: "/etc/nginx/nginx.conf", MarkerLine: 1},
+		{Path: "/etc/nginx/conf.d/default.conf", MarkerLine: 4},
+	}
+
+	findings := lintConfig(resp, files)
+
+	expected := []struct {
+		Check string
+		File  string
+		Line  int
+	}{
+		{"server_tokens", "/etc/nginx/nginx.conf", 1},
+		{"host_spoofing", "/etc/nginx/conf.d/default.conf", 3},
+		{"add_header_redefinition", "/etc/nginx/conf.d/default.conf", 4},
+		{"alias_traversal", "/etc/nginx/conf.d/default.conf", 5},
+		{"ssrf", "/etc/nginx/conf.d/default.conf", 10},
+		{"http_splitting", "/etc/nginx/conf.d/default.conf", 15},
+		{"origin_regex", "/etc/nginx/conf.d/default.conf", 19},
+		{"origin_regex", "/etc/nginx/conf.d/default.conf", 22},
+	}
+
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %v findings, got %v: %+v", len(expected), len(findings), findings)
+	}
+
+	for i, e := range expected {
+		f := findings[i]
+
+		if f.Check != e.Check || f.File != e.File || f.Line != e.Line {
+			t.Errorf("expected finding %v to be %v at %v:%v, got %+v", i, e.Check, e.File, e.Line, f)
+		}
+
+		if f.Severity == "" || f.Message == "" {
+			t.Errorf("finding %v is missing severity or message: %+v", i, f)
+		}
+	}
+}
+
+func TestSplitConfigFiles(t *testing.T) {
+	output := "# configuration file /etc/nginx/nginx.conf:\nuser nginx;\ninclude conf.d/*.conf;\n\n# configuration file /etc/nginx/conf.d/default.conf:\nserver {\n}\n"
+
+	files := splitConfigFiles(output)
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+
+	tests := []struct {
+		Line         int
+		ExpectedFile string
+		ExpectedLine int
+	}{
+		{2, "/etc/nginx/nginx.conf", 1},
+		{3, "/etc/nginx/nginx.conf", 2},
+		{6, "/etc/nginx/conf.d/default.conf", 1},
+	}
+
+	for _, test := range tests {
+		file, line := files.Locate(test.Line)
+
+		if file != test.ExpectedFile || line != test.ExpectedLine {
+			t.Errorf("expected line %v to be %v:%v, got %v:%v", test.Line, test.ExpectedFile, test.ExpectedLine, file, line)
+		}
+	}
+
+	if file, line := splitConfigFiles("user nginx;").Locate(1); file != "" || line != 1 {
+		t.Errorf("expected output without markers to be unchanged, got %v:%v", file, line)
+	}
+}
+
+func TestCheckAddHeaderRedefinition(t *testing.T) {
+	server := crossplane.Directive{
+		Directive: "server",
+		Block: []crossplane.Directive{
+			{Directive: "add_header", Args: []string{"X-Frame-Options", "DENY"}},
+			{Directive: "add_header", Args: []string{"X-Content-Type-Options", "nosniff"}},
+		},
+	}
+
+	tests := map[string]struct {
+		Headers []string
+		Found   bool
+	}{
+		"repeats every header": {[]string{"x-frame-options", "X-Content-Type-Options", "Cache-Control"}, false},
+		"drops a header":       {[]string{"X-Frame-Options", "Cache-Control"}, true},
+		"sets no headers":      {nil, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			location := crossplane.Directive{Directive: "location", Args: []string{"/"}}
+
+			for _, h := range test.Headers {
+				location.Block = append(location.Block, crossplane.Directive{Directive: "add_header", Args: []string{h, "value"}})
+			}
+
+			message, found := checkAddHeaderRedefinition(location, []crossplane.Directive{{Directive: "http"}, server})
+
+			if found != test.Found {
+				t.Errorf("expected found to be %v, got %v: %v", test.Found, found, message)
+			}
+
+			if found && !strings.HasSuffix(message, ": X-Content-Type-Options") {
+				t.Errorf("expected the dropped header to be listed, got %v", message)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package sources
+
+import (
+	"path"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// NginxModule A module that is compiled into nginx or loaded dynamically
+type NginxModule struct {
+	// The name of the module e.g. `ngx_http_ssl_module`. For third-party
+	// modules this is the name of the source directory e.g.
+	// `headers-more-nginx-module`
+	Name string
+
+	// Either `static` or `dynamic`
+	Type string
+
+	// Where the module comes from: `builtin` for modules that are part of
+	// nginx, `addon` for third-party modules from `--add-module` or
+	// `--add-dynamic-module`, or `unknown` for modules that are loaded but
+	// weren't part of the build
+	Origin string
+
+	// Whether the module is in use. Static modules are always loaded, dynamic
+	// modules only if there is a `load_module` directive
+	Loaded bool
+
+	// The path to the shared object for loaded dynamic modules, or the source
+	// directory for third-party modules
+	Path string
+
+	// The config file containing the `load_module` directive
+	File string
+
+	// The source directory of third-party modules. Loaded third-party dynamic
+	// modules are named after their shared object since one source directory
+	// can build several e.g. njs builds `ngx_http_js_module` and
+	// `ngx_stream_js_module`
+	Source string
+}
+
+// defaultModules Modules that are built unless disabled with `--without-`.
+// The mail and stream modules are only included if those subsystems are
+// enabled
+var defaultModules = map[string][]string{
+	"http": {
+		"http_access_module", "http_auth_basic_module", "http_autoindex_module",
+		"http_browser_module", "http_charset_module", "http_empty_gif_module",
+		"http_fastcgi_module", "http_geo_module", "http_grpc_module",
+		"http_gzip_module", "http_limit_conn_module", "http_limit_req_module",
+		"http_map_module", "http_memcached_module", "http_mirror_module",
+		"http_proxy_module", "http_referer_module", "http_rewrite_module",
+		"http_scgi_module", "http_split_clients_module", "http_ssi_module",
+		"http_upstream_hash_module", "http_upstream_ip_hash_module",
+		"http_upstream_keepalive_module", "http_upstream_least_conn_module",
+		"http_upstream_random_module", "http_upstream_zone_module",
+		"http_userid_module", "http_uwsgi_module",
+	},
+	"mail": {
+		"mail_imap_module", "mail_pop3_module", "mail_smtp_module",
+	},
+	"stream": {
+		"stream_access_module", "stream_geo_module", "stream_limit_conn_module",
+		"stream_map_module", "stream_proxy_module", "stream_return_module",
+		"stream_set_module", "stream_split_clients_module",
+		"stream_upstream_hash_module", "stream_upstream_least_conn_module",
+		"stream_upstream_random_module", "stream_upstream_zone_module",
+	},
+}
+
+// moduleName Converts the name used in configure arguments e.g.
+// `http_ssl_module` or `mail` to the module's name
+func moduleName(name string) string {
+	if !strings.HasSuffix(name, "_module") {
+		name += "_module"
+	}
+
+	return "ngx_" + name
+}
+
+// addonModuleName Returns the name of a third-party module from the path to
+// its source. Some modules such as njs keep the nginx module in a
+// subdirectory called `nginx` so the parent is used instead
+func addonModuleName(source string) string {
+	source = strings.TrimRight(source, "/")
+	name := path.Base(source)
+
+	if name == "nginx" {
+		name = path.Base(path.Dir(source))
+	}
+
+	return name
+}
+
+// moduleNameNoise Words in module and source directory names that don't
+// identify the module
+var moduleNameNoise = map[string]bool{
+	"ngx": true, "nginx": true, "module": true, "http": true, "stream": true,
+	"mail": true, "filter": true,
+}
+
+// moduleNameAliases Third-party modules whose source directory has a
+// different name to the modules that it builds
+var moduleNameAliases = map[string]string{
+	"njs": "js",
+	"vts": "vhost_traffic_status",
+}
+
+// moduleNameWords Returns the words in the name of a module or its source
+// directory that identify it e.g. `headers` and `more` for both
+// `headers-more-nginx-module` and `ngx_http_headers_more_filter_module`
+func moduleNameWords(name string) []string {
+	var words []string
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+		if alias, ok := moduleNameAliases[word]; ok {
+			words = append(words, strings.Split(alias, "_")...)
+		} else if !moduleNameNoise[word] {
+			words = append(words, word)
+		}
+	}
+
+	return words
+}
+
+// addonBuilds Returns whether a shared object could have been built from a
+// third-party module's source directory, which is the case if every word
+// identifying the source is in the name of the shared object
+func addonBuilds(source string, name string) bool {
+	sourceWords := moduleNameWords(addonModuleName(source))
+
+	if len(sourceWords) == 0 {
+		return false
+	}
+
+	nameWords := make(map[string]bool)
+
+	for _, word := range moduleNameWords(name) {
+		nameWords[word] = true
+	}
+
+	for _, word := range sourceWords {
+		if !nameWords[word] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listModules Returns all modules that are compiled in, or loaded using
+// `load_module`. Relative paths to dynamic modules in the `modules` directory
+// are resolved against the modules path from the build profile, since this is
+// often a symlink to it, and other relative paths against the prefix
+func listModules(profile NginxBuildProfile, resp crossplane.Response, files configFileMap, resolver pathResolver) []NginxModule {
+	var modules []NginxModule
+
+	index := make(map[string]int)
+
+	add := func(m NginxModule) {
+		if i, ok := index[m.Name]; ok {
+			modules[i] = m
+			return
+		}
+
+		index[m.Name] = len(modules)
+		modules = append(modules, m)
+	}
+
+	disabled := make(map[string]bool)
+
+	for _, name := range profile.DisabledModules {
+		disabled[name] = true
+	}
+
+	subsystems := []string{"http"}
+
+	if disabled["http"] {
+		subsystems = nil
+	}
+
+	for _, name := range profile.EnabledModules {
+		if name == "mail" || name == "stream" {
+			subsystems = append(subsystems, name)
+		}
+	}
+
+	for _, subsystem := range subsystems {
+		for _, name := range defaultModules[subsystem] {
+			if !disabled[name] {
+				add(NginxModule{Name: moduleName(name), Type: "static", Origin: "builtin", Loaded: true})
+			}
+		}
+	}
+
+	for _, name := range profile.EnabledModules {
+		add(NginxModule{Name: moduleName(name), Type: "static", Origin: "builtin", Loaded: true})
+	}
+
+	for _, source := range profile.AddModules {
+		add(NginxModule{Name: addonModuleName(source), Type: "static", Origin: "addon", Loaded: true, Path: source, Source: source})
+	}
+
+	for _, name := range profile.DynamicModules {
+		add(NginxModule{Name: moduleName(name), Type: "dynamic", Origin: "builtin"})
+	}
+
+	for _, source := range profile.AddDynamicModules {
+		add(NginxModule{Name: addonModuleName(source), Type: "dynamic", Origin: "addon", Path: source, Source: source})
+	}
+
+	// Third-party modules that have been loaded, which are replaced by the
+	// shared objects that were loaded from them
+	loadedAddons := make(map[string]bool)
+
+	root, files := combineConfigs(resp, files)
+
+	for _, d := range root.Descendants("load_module") {
+		if len(d.Args) == 0 {
+			continue
+		}
+
+		modulePath := d.Args[0]
+
+		if strings.HasPrefix(modulePath, "modules/") && profile.ModulesPath != "" {
+			modulePath = path.Join(profile.ModulesPath, strings.TrimPrefix(modulePath, "modules/"))
+		} else {
+			modulePath = resolver.Resolve(modulePath, false)
+		}
+
+		file, _ := files.Locate(d.Line)
+		name := strings.TrimSuffix(path.Base(modulePath), ".so")
+
+		m := NginxModule{
+			Name:   name,
+			Type:   "dynamic",
+			Origin: "unknown",
+			Loaded: true,
+			Path:   modulePath,
+			File:   file,
+		}
+
+		if i, ok := index[name]; ok {
+			m.Origin = modules[i].Origin
+			m.Source = modules[i].Source
+		} else {
+			for _, source := range profile.AddDynamicModules {
+				if addonBuilds(source, name) {
+					m.Origin = "addon"
+					m.Source = source
+					loadedAddons[addonModuleName(source)] = true
+
+					break
+				}
+			}
+		}
+
+		add(m)
+	}
+
+	if len(loadedAddons) == 0 {
+		return modules
+	}
+
+	listed := make([]NginxModule, 0, len(modules))
+
+	for _, m := range modules {
+		if m.Origin == "addon" && m.Type == "dynamic" && !m.Loaded && loadedAddons[m.Name] {
+			continue
+		}
+
+		listed = append(listed, m)
+	}
+
+	return listed
+}
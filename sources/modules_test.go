@@ -0,0 +1,123 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+func TestAddonBuilds(t *testing.T) {
+	tests := []struct {
+		Source   string
+		Name     string
+		Expected bool
+	}{
+		{"/build/headers-more-nginx-module", "ngx_http_headers_more_filter_module", true},
+		{"/build/njs/nginx", "ngx_http_js_module", true},
+		{"/build/njs/nginx", "ngx_stream_js_module", true},
+		{"/build/ngx_brotli", "ngx_http_brotli_static_module", true},
+		{"/build/nginx-module-vts", "ngx_http_vhost_traffic_status_module", true},
+		{"/build/ngx_http_geoip2_module", "ngx_http_geoip2_module", true},
+		{"/build/njs/nginx", "ngx_http_json_module", false},
+		{"/build/headers-more-nginx-module", "ngx_http_headers_module", false},
+		{"/build/ngx_brotli", "ngx_http_perl_module", false},
+	}
+
+	for _, test := range tests {
+		if builds := addonBuilds(test.Source, test.Name); builds != test.Expected {
+			t.Errorf("expected %v to build %v to be %v, got %v", test.Source, test.Name, test.Expected, builds)
+		}
+	}
+}
+
+func TestListModules(t *testing.T) {
+	profile := parseBuildProfile([]string{
+		"--modules-path=/usr/lib/nginx/modules",
+		"--with-http_ssl_module",
+		"--with-http_perl_module=dynamic",
+		"--with-stream=dynamic",
+		"--without-http_autoindex_module",
+		"--add-module=/build/headers-more-nginx-module",
+		"--add-dynamic-module=/build/njs/nginx",
+		"--add-dynamic-module=/build/ngx_brotli",
+	})
+
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/tmp/crossplane123",
+				Parsed: []crossplane.Directive{
+					{Directive: "include", Args: []string{"/etc/nginx/modules-enabled/*.conf"}, Line: 2},
+					{Directive: "load_module", Args: []string{"modules/ngx_http_perl_module.so"}, Line: 5},
+					{Directive: "load_module", Args: []string{"/opt/modules/ngx_http_geoip2_module.so"}, Line: 6},
+					{Directive: "load_module", Args: []string{"modules/ngx_http_js_module.so"}, Line: 7},
+				},
+			},
+		},
+	}
+
+	files := configFileMap{
+		{Path: "/etc/nginx/nginx.conf", MarkerLine: 1},
+		{Path: "/etc/nginx/modules-enabled/50-mod-http-perl.conf", MarkerLine: 4},
+	}
+
+	modules := make(map[string]NginxModule)
+
+	for _, m := range listModules(profile, resp, files, pathResolver{}) {
+		modules[m.Name] = m
+	}
+
+	expected := map[string]NginxModule{
+		"ngx_http_proxy_module":     {Name: "ngx_http_proxy_module", Type: "static", Origin: "builtin", Loaded: true},
+		"ngx_http_ssl_module":       {Name: "ngx_http_ssl_module", Type: "static", Origin: "builtin", Loaded: true},
+		"headers-more-nginx-module": {Name: "headers-more-nginx-module", Type: "static", Origin: "addon", Loaded: true, Path: "/build/headers-more-nginx-module", Source: "/build/headers-more-nginx-module"},
+		"ngx_stream_module":         {Name: "ngx_stream_module", Type: "dynamic", Origin: "builtin"},
+		"ngx_brotli":                {Name: "ngx_brotli", Type: "dynamic", Origin: "addon", Path: "/build/ngx_brotli", Source: "/build/ngx_brotli"},
+		"ngx_http_js_module": {
+			Name:   "ngx_http_js_module",
+			Type:   "dynamic",
+			Origin: "addon",
+			Loaded: true,
+			Path:   "/usr/lib/nginx/modules/ngx_http_js_module.so",
+			File:   "/etc/nginx/modules-enabled/50-mod-http-perl.conf",
+			Source: "/build/njs/nginx",
+		},
+		"ngx_http_perl_module": {
+			Name:   "ngx_http_perl_module",
+			Type:   "dynamic",
+			Origin: "builtin",
+			Loaded: true,
+			Path:   "/usr/lib/nginx/modules/ngx_http_perl_module.so",
+			File:   "/etc/nginx/modules-enabled/50-mod-http-perl.conf",
+		},
+		"ngx_http_geoip2_module": {
+			Name:   "ngx_http_geoip2_module",
+			Type:   "dynamic",
+			Origin: "unknown",
+			Loaded: true,
+			Path:   "/opt/modules/ngx_http_geoip2_module.so",
+			File:   "/etc/nginx/modules-enabled/50-mod-http-perl.conf",
+		},
+	}
+
+	for name, e := range expected {
+		if m, ok := modules[name]; !ok {
+			t.Errorf("expected module %v to be listed", name)
+		} else if m != e {
+			t.Errorf("expected %v to be %+v, got %+v", name, e, m)
+		}
+	}
+
+	// The loaded shared object replaces the module's source directory
+	if _, ok := modules["njs"]; ok {
+		t.Error("expected loaded addon njs to be listed by its shared object")
+	}
+
+	if _, ok := modules["ngx_http_autoindex_module"]; ok {
+		t.Error("expected disabled module ngx_http_autoindex_module not to be listed")
+	}
+
+	if _, ok := modules["ngx_stream_proxy_module"]; ok {
+		t.Error("expected stream modules not to be listed when stream is dynamic")
+	}
+}
@@ -6,21 +6,56 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/overmindtech/discovery"
-	"github.com/overmindtech/nginx-source/crossplane"
 	"github.com/overmindtech/nginx-source/triggers"
 	"github.com/overmindtech/sdp-go"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// Types of CollectionError
+const (
+	CollectionErrorFailed   = "failed"
+	CollectionErrorNotFound = "notfound"
+)
+
+// CollectionError A command that failed while gathering the details of an
+// instance. The item is still returned with whatever else could be gathered
+type CollectionError struct {
+	Command string
+	Type    string
+	Error   string
+}
+
 type NginxSource struct {
 	Engine *discovery.Engine
+
+	// Optional user-defined rules that each config is checked against
+	Policy *Policy
+
+	// The security advisories that versions are checked against. If this is
+	// nil the bundled advisories are used
+	Advisories []Advisory
+
+	// How long discovered instances are returned by Find after they were last
+	// seen. Defaults to DefaultInstanceTTL
+	InstanceTTL time.Duration
+
+	// The name of the Kubernetes cluster, used to build the contexts of the
+	// Ingresses and Services that ingress-nginx config is linked to
+	KubernetesCluster string
+
+	registry instanceRegistry
+
+	// Runs commands in place of the `command` source so that tests don't need
+	// NATS. If this is nil commands are sent using the Engine
+	run func(itemContext string, command string) ([]*sdp.Item, []*sdp.ItemRequestError, error)
 }
 
 // Type The type of items that this source is capable of finding
@@ -42,21 +77,78 @@ func (s *NginxSource) Contexts() []string {
 	}
 }
 
-// Get This method does not work for Nginx as there iosn't really any specific
-// thing that differentiates one Nginx instance from another, the
-// UniqueAttribute I'm using as the SHA1 hash of all of the server's confuration
-// as this is all I could think of that would ensure that a server was unique
+// Get Re-collects the details of a specific nginx instance. The query is the
+// value of the `instance` attribute, which is the binary followed by its
+// prefix and config file e.g. `/usr/sbin/nginx -p /etc/nginx -c
+// /etc/nginx/nginx.conf`. If the instance has already been discovered it is
+// re-collected with the arguments it was found with, since the ID leaves out
+// `-g` and `-e`
 func (s *NginxSource) Get(ctx context.Context, itemContext string, query string) (*sdp.Item, error) {
-	return nil, &sdp.ItemRequestError{
-		ErrorType:   sdp.ItemRequestError_OTHER,
-		ErrorString: "Get is not supported for this source since nginx instances don't have a truly unique identifier. Use Search instead",
-		Context:     itemContext,
+	instance, found := s.registry.Lookup(itemContext, query)
+
+	if !found {
+		var err error
+
+		instance, err = parseInstanceID(query)
+
+		if err != nil {
+			return nil, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: err.Error(),
+				Context:     itemContext,
+			}
+		}
+	}
+
+	item, err := s.collect(ctx, itemContext, instance)
+
+	if err != nil {
+		return nil, err
 	}
+
+	s.registry.Add(itemContext, item.UniqueAttributeValue(), instance, time.Now())
+
+	return item, nil
 }
 
-// Find Not supported for this source
+// Find Re-collects every instance in the context that has been discovered by
+// a trigger, Search or Get within the last InstanceTTL. Instances that can't be
+// collected are left out
 func (s *NginxSource) Find(ctx context.Context, itemContext string) ([]*sdp.Item, error) {
-	return []*sdp.Item{}, nil
+	ttl := s.InstanceTTL
+
+	if ttl == 0 {
+		ttl = DefaultInstanceTTL
+	}
+
+	known := s.registry.List(itemContext, ttl, time.Now())
+	collected := make([]*sdp.Item, len(known))
+	wg := sync.WaitGroup{}
+
+	for i, k := range known {
+		wg.Add(1)
+
+		go func(i int, k knownInstance) {
+			defer wg.Done()
+
+			if item, err := s.collect(ctx, k.Context, k.Instance); err == nil {
+				s.registry.Add(k.Context, item.UniqueAttributeValue(), k.Instance, time.Now())
+				collected[i] = item
+			}
+		}(i, k)
+	}
+
+	wg.Wait()
+
+	items := make([]*sdp.Item, 0, len(collected))
+
+	for _, item := range collected {
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
 }
 
 // Search Looks for nginx instance in a given context. The query should be one
@@ -64,7 +156,21 @@ func (s *NginxSource) Find(ctx context.Context, itemContext string) ([]*sdp.Item
 //
 // * `service-linux`: This looks for nginx on a linux server which has the
 // nginx service running
+// * `process`: This looks for nginx using the command line of a running
+// master process
+// * `container`: This looks for nginx inside a container by running commands
+// with `docker exec`
+// * `package`: This looks for nginx using the default binary and config file
+// of an installed package
+// * `socket`: This looks for the nginx that owns a listening socket
+//
+// Queries that aren't trigger JSON identify the instance directly, see
+// InstanceQuery for the supported forms
 func (s *NginxSource) Search(ctx context.Context, itemContext string, query string) ([]*sdp.Item, error) {
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		return s.searchInstance(ctx, itemContext, query)
+	}
+
 	var triggerData triggers.TriggerData
 
 	err := json.Unmarshal([]byte(query), &triggerData)
@@ -77,6 +183,8 @@ func (s *NginxSource) Search(ctx context.Context, itemContext string, query stri
 		}
 	}
 
+	var instance NginxInstance
+
 	switch triggerData.TriggerType {
 	case triggers.SERVICE:
 		// I possibly don't even need to look for the config file etc. I could
@@ -85,126 +193,119 @@ func (s *NginxSource) Search(ctx context.Context, itemContext string, query stri
 		// * `nginx -V`: Version info and many arguments
 		// * `nginx -Tq`: All config concatenated perfectly for crossplane
 
-		// Extract the arguments that are being passed to nginx from the service
-		// as well as the path to the binary itself
-		versionCommand := fmt.Sprintf("%v -V %v", triggerData.ServiceData.Binary, strings.Join(triggerData.ServiceData.Args, " "))
-		configCommand := fmt.Sprintf("%v -Tq", triggerData.ServiceData.Binary)
-		versionUUID := uuid.New()
-		configUUID := uuid.New()
-
-		versionRequest := sdp.ItemRequest{
-			Type:            "command",
-			Method:          sdp.RequestMethod_GET,
-			Query:           versionCommand,
-			LinkDepth:       0,
-			Context:         itemContext,
-			Timeout:         durationpb.New(10 * time.Second),
-			ItemSubject:     discovery.NewItemSubject(),
-			ResponseSubject: discovery.NewResponseSubject(),
-			IgnoreCache:     false,
-			UUID:            versionUUID[:],
+		if triggerData.ServiceData == nil {
+			return []*sdp.Item{}, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "service trigger is missing service_data",
+				Context:     itemContext,
+			}
 		}
 
-		configRequest := sdp.ItemRequest{
-			Type:            "command",
-			Method:          sdp.RequestMethod_GET,
-			Query:           configCommand,
-			LinkDepth:       0,
-			Context:         itemContext,
-			IgnoreCache:     false,
-			UUID:            configUUID[:],
-			Timeout:         durationpb.New(10 * time.Second),
-			ItemSubject:     discovery.NewItemSubject(),
-			ResponseSubject: discovery.NewResponseSubject(),
+		// Extract the arguments that are being passed to nginx from the service
+		// as well as the path to the binary itself, these are passed to every
+		// command so that they see the same config as the service
+		instance = NginxInstance{
+			Binary: triggerData.ServiceData.Binary,
+			Args:   parseNginxArgs(triggerData.ServiceData.Args),
+		}
+	case triggers.PROCESS:
+		if triggerData.ProcessData == nil {
+			return []*sdp.Item{}, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "process trigger is missing process_data",
+				Context:     itemContext,
+			}
 		}
 
-		wg := sync.WaitGroup{}
-
-		wg.Add(2)
-
-		var versionItems []*sdp.Item
-		var versionErrs []*sdp.ItemRequestError
-		var versionErr error
-		var configItems []*sdp.Item
-		var configErrs []*sdp.ItemRequestError
-		var configErr error
-
-		// Execute both requests
-		go func() {
-			defer wg.Done()
-			progress := sdp.NewRequestProgress(&versionRequest)
-
-			versionItems, versionErrs, versionErr = progress.Execute(s.Engine.ManagedConnection())
-		}()
-
-		go func() {
-			defer wg.Done()
-
-			progress := sdp.NewRequestProgress(&configRequest)
-
-			configItems, configErrs, configErr = progress.Execute(s.Engine.ManagedConnection())
-		}()
-
-		wg.Wait()
+		instance = NginxInstance{
+			Binary: triggerData.ProcessData.Binary,
+			Args:   parseNginxArgs(triggerData.ProcessData.Args),
+		}
 
-		if configErr != nil || versionErr != nil {
+		// If the command line didn't contain the full path to the binary and
+		// the process item didn't have its executable, the pid is used to
+		// find the executable that the master is running
+		if !path.IsAbs(instance.Binary) && triggerData.ProcessData.PID != 0 {
+			if exe, collectionErr := s.commandStdout(itemContext, fmt.Sprintf("readlink /proc/%v/exe", triggerData.ProcessData.PID)); collectionErr == nil && strings.TrimSpace(exe) != "" {
+				instance.Binary = strings.TrimSpace(exe)
+			}
+		}
+	case triggers.CONTAINER:
+		if triggerData.ContainerData == nil {
 			return []*sdp.Item{}, &sdp.ItemRequestError{
 				ErrorType:   sdp.ItemRequestError_OTHER,
-				ErrorString: fmt.Sprintf("error gathering nginx info: %v%v", configErr, versionErr),
+				ErrorString: "container trigger is missing container_data",
 				Context:     itemContext,
 			}
 		}
 
-		// Validate that we got one item for each and extract the useful data
-		if len(versionItems) != 1 {
+		// nginx images run nginx from the PATH with the default config, so
+		// only the container is needed
+		instance = NginxInstance{
+			Container: triggerData.ContainerData.ID,
+		}
+	case triggers.PACKAGE:
+		if triggerData.PackageData == nil {
 			return []*sdp.Item{}, &sdp.ItemRequestError{
-				ErrorType:   sdp.ItemRequestError_NOTFOUND,
-				ErrorString: fmt.Sprintf("error gathering nginx info: expected 1 version item but got %v\nErrors: %v", len(versionItems), versionErrs),
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "package trigger is missing package_data",
 				Context:     itemContext,
 			}
 		}
 
-		if len(configItems) != 1 {
+		instance = NginxInstance{
+			Binary: triggerData.PackageData.Binary,
+			Args: NginxArgs{
+				ConfFile: triggerData.PackageData.ConfFile,
+			},
+		}
+	case triggers.SOCKET:
+		if triggerData.SocketData == nil {
 			return []*sdp.Item{}, &sdp.ItemRequestError{
-				ErrorType:   sdp.ItemRequestError_NOTFOUND,
-				ErrorString: fmt.Sprintf("error gathering nginx info: expected 1 version item but got %v\nErrors: %v", len(configItems), configErrs),
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "socket trigger is missing socket_data",
 				Context:     itemContext,
 			}
 		}
 
-		versionItem := versionItems[0]
-		configItem := configItems[0]
-		attrMap := make(map[string]interface{})
+		// The pid identifies the process directly, otherwise find whichever
+		// nginx is listening on the port
+		q := InstanceQuery{PID: triggerData.SocketData.PID}
 
-		if stderr, err := versionItem.Attributes.Get("stderr"); err == nil {
-			versionInfo := parseVersionInfo(fmt.Sprint(stderr))
-
-			attrMap["version"] = versionInfo.Version
-			attrMap["builtBy"] = versionInfo.BuiltBy
-			attrMap["openSSL"] = versionInfo.OpenSSL
-			attrMap["configArgs"] = versionInfo.ConfigArgs
+		if q.PID == 0 {
+			q = InstanceQuery{Port: triggerData.SocketData.Port}
 		}
 
-		if stdout, err := configItem.Attributes.Get("stdout"); err == nil {
-			resp, err := crossplane.Parse(ctx, fmt.Sprint(stdout))
+		instance, err = s.resolveInstanceQuery(itemContext, q)
 
-			if err != nil {
-				return []*sdp.Item{}, &sdp.ItemRequestError{
-					ErrorType:   sdp.ItemRequestError_OTHER,
-					ErrorString: fmt.Sprintf("error parsing nginx config: %v", err),
-					Context:     itemContext,
-				}
-			}
+		if err != nil {
+			return []*sdp.Item{}, itemRequestError(itemContext, err)
+		}
+	default:
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_NOTFOUND,
+			ErrorString: fmt.Sprintf("query %v not supported", query),
+			Context:     itemContext,
+		}
+	}
 
-			attrMap["config"] = resp.Config
+	item, err := s.collect(ctx, itemContext, instance)
 
-			shaSum := sha1.Sum([]byte(fmt.Sprint(stdout)))
-			shaString := base64.URLEncoding.EncodeToString(shaSum[:])
+	if err != nil {
+		return []*sdp.Item{}, err
+	}
 
-			attrMap["configHash"] = shaString
-		}
+	// Remember the instance so that it can be returned by Find
+	s.registry.Add(itemContext, item.UniqueAttributeValue(), instance, time.Now())
 
-		attributes, err := sdp.ToAttributes(attrMap)
+	if triggerData.PackageData != nil {
+		// Record the package so that its version can be compared with the
+		// installed build
+		err = item.Attributes.Set("package", map[string]interface{}{
+			"Name":       triggerData.PackageData.Name,
+			"Version":    triggerData.PackageData.Version,
+			"Maintainer": triggerData.PackageData.Maintainer,
+		})
 
 		if err != nil {
 			return []*sdp.Item{}, &sdp.ItemRequestError{
@@ -213,26 +314,338 @@ func (s *NginxSource) Search(ctx context.Context, itemContext string, query stri
 				Context:     itemContext,
 			}
 		}
+	}
+
+	if triggerData.TriggerItemRef != nil {
+		item.LinkedItems = append(item.LinkedItems, triggerData.TriggerItemRef)
+
+		if triggerData.SocketData != nil {
+			linkServerSockets(item, triggerData.SocketData.Address, triggerData.SocketData.Port, triggerData.TriggerItemRef)
+		}
+	}
+
+	return []*sdp.Item{item}, nil
+}
+
+// searchInstance Searches for an instance using an InstanceQuery
+func (s *NginxSource) searchInstance(ctx context.Context, itemContext string, query string) ([]*sdp.Item, error) {
+	q, err := parseInstanceQuery(query)
+
+	if err != nil {
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: err.Error(),
+			Context:     itemContext,
+		}
+	}
+
+	instance, err := s.resolveInstanceQuery(itemContext, q)
+
+	if err != nil {
+		return []*sdp.Item{}, itemRequestError(itemContext, err)
+	}
+
+	item, err := s.collect(ctx, itemContext, instance)
+
+	if err != nil {
+		return []*sdp.Item{}, err
+	}
+
+	s.registry.Add(itemContext, item.UniqueAttributeValue(), instance, time.Now())
+
+	return []*sdp.Item{item}, nil
+}
+
+// itemRequestError Returns an error as an ItemRequestError, keeping the type
+// of errors that already are one
+func itemRequestError(itemContext string, err error) error {
+	if _, ok := err.(*sdp.ItemRequestError); ok {
+		return err
+	}
+
+	return &sdp.ItemRequestError{
+		ErrorType:   sdp.ItemRequestError_OTHER,
+		ErrorString: err.Error(),
+		Context:     itemContext,
+	}
+}
+
+// collect Gathers the details of an nginx instance by running commands
+// against it using the `command` source
+func (s *NginxSource) collect(ctx context.Context, itemContext string, instance NginxInstance) (*sdp.Item, error) {
+	versionCommand := instance.Command("-V")
+	configCommand := instance.Command("-Tq")
+	testCommand := instance.Command("-t")
+	wg := sync.WaitGroup{}
+
+	wg.Add(3)
+
+	var versionItems []*sdp.Item
+	var versionErrs []*sdp.ItemRequestError
+	var versionErr error
+	var configItems []*sdp.Item
+	var configErrs []*sdp.ItemRequestError
+	var configErr error
+	var testItems []*sdp.Item
+	var testErrs []*sdp.ItemRequestError
+	var testErr error
+
+	// Execute all requests
+	go func() {
+		defer wg.Done()
+
+		versionItems, versionErrs, versionErr = s.runCommand(itemContext, versionCommand)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		configItems, configErrs, configErr = s.runCommand(itemContext, configCommand)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		testItems, testErrs, testErr = s.runCommand(itemContext, testCommand)
+	}()
+
+	wg.Wait()
+
+	// Use whatever could be gathered, only failing if neither command
+	// returned anything
+	var collectionErrors []CollectionError
+
+	versionItem, versionCollectionErr := singleItem(versionCommand, versionItems, versionErrs, versionErr)
+	configItem, configCollectionErr := singleItem(configCommand, configItems, configErrs, configErr)
+
+	for _, collectionErr := range []*CollectionError{versionCollectionErr, configCollectionErr} {
+		if collectionErr != nil {
+			collectionErrors = append(collectionErrors, *collectionErr)
+		}
+	}
 
-		item := sdp.Item{
-			Type:            "nginx",
-			UniqueAttribute: "configHash", // This is the SHA1 of all of the config
-			Attributes:      attributes,
-			Context:         itemContext,
+	if versionItem == nil && configItem == nil {
+		errorType := sdp.ItemRequestError_OTHER
+
+		if versionCollectionErr.Type == CollectionErrorNotFound && configCollectionErr.Type == CollectionErrorNotFound {
+			errorType = sdp.ItemRequestError_NOTFOUND
 		}
 
-		if triggerData.TriggerItemRef != nil {
-			item.LinkedItems = append(item.LinkedItems, triggerData.TriggerItemRef)
+		return nil, &sdp.ItemRequestError{
+			ErrorType:   errorType,
+			ErrorString: fmt.Sprintf("error gathering nginx info: %v; %v", versionCollectionErr.Error, configCollectionErr.Error),
+			Context:     itemContext,
 		}
+	}
+
+	attrMap := make(map[string]interface{})
+	attrMap["binary"] = instance.Binary
+	attrMap["args"] = instance.Args
 
-		return []*sdp.Item{&item}, nil
+	if instance.Container != "" {
+		attrMap["container"] = instance.Container
+	}
+
+	var linkedItemRequests []*sdp.ItemRequest
+	var versionInfo NginxVersionInfo
+
+	if versionItem != nil {
+		versionInfo = parseVersionInfo(commandOutput(versionItem, "stderr"))
+
+		attrMap["version"] = versionInfo.Version
+		attrMap["product"] = versionInfo.Product
+		attrMap["coreVersion"] = versionInfo.CoreVersion
+		attrMap["forkVersion"] = versionInfo.ForkVersion
+		attrMap["components"] = versionInfo.Components
+		attrMap["builtBy"] = versionInfo.BuiltBy
+		attrMap["openSSL"] = versionInfo.OpenSSL
+		attrMap["sslLibrary"] = versionInfo.SSLLibrary
+		attrMap["runningOpenSSL"] = versionInfo.RunningOpenSSL
+		attrMap["openSSLMismatch"] = versionInfo.OpenSSLMismatch
+		attrMap["tlsSNI"] = versionInfo.TLSSNI
+		attrMap["compiler"] = versionInfo.Compiler
+		attrMap["compilerVersion"] = versionInfo.CompilerVersion
+		attrMap["unrecognisedVersionLines"] = versionInfo.UnrecognisedLines
+		attrMap["configArgs"] = versionInfo.ConfigArgs
+		attrMap["buildProfile"] = versionInfo.BuildProfile
+
+		if coveredByAdvisories(versionInfo) {
+			attrMap["vulnerabilities"] = findVulnerabilities(s.advisories(), versionInfo.CoreVersion, versionInfo.ConfigArgs)
+		}
+	}
+
+	resolver := newPathResolver(instance.Args, versionInfo.BuildProfile)
+	instanceID := instance.ID(versionInfo.BuildProfile)
+	attrMap["instance"] = instanceID
+
+	// The config test is optional, failing to run it shouldn't stop the
+	// rest of the details being returned
+	if testItem, testCollectionErr := singleItem(testCommand, testItems, testErrs, testErr); testCollectionErr != nil {
+		collectionErrors = append(collectionErrors, *testCollectionErr)
+	} else if exitCode, err := commandExitCode(testItem); err == nil {
+		attrMap["configTest"] = parseConfigTest(exitCode, commandOutput(testItem, "stderr"))
+	}
+
+	var configExitCode int
+
+	if configItem != nil {
+		configExitCode, _ = commandExitCode(configItem)
+	}
+
+	switch {
+	case configItem == nil:
+		// The error has already been recorded
+	case configExitCode != 0:
+		// nginx doesn't print the config if it's invalid, in which case
+		// the errors are reported instead so that the item still exists
+		// with its version details
+		stdout := commandOutput(configItem, "stdout")
+		stderr := commandOutput(configItem, "stderr")
+
+		attrMap["configStatus"] = "invalid"
+		attrMap["configErrors"] = parseConfigTest(configExitCode, stderr).Messages
+		attrMap["configHash"] = hashConfig(stdout + stderr)
 	default:
-		return []*sdp.Item{}, &sdp.ItemRequestError{
-			ErrorType:   sdp.ItemRequestError_NOTFOUND,
-			ErrorString: fmt.Sprintf("query %v not supported", query),
+		stdout := commandOutput(configItem, "stdout")
+
+		attrMap["configHash"] = hashConfig(stdout)
+
+		files := splitConfigFiles(stdout)
+		resp, err := parseConfigOutput(ctx, stdout, files)
+
+		if err != nil {
+			collectionErrors = append(collectionErrors, CollectionError{
+				Command: "crossplane",
+				Type:    CollectionErrorFailed,
+				Error:   fmt.Sprintf("error parsing nginx config: %v", err),
+			})
+
+			break
+		}
+
+		mergeGlobals(&resp, instance.Args.Globals)
+
+		attrMap["configStatus"] = "valid"
+		attrMap["config"] = resp.Config
+
+		attrMap["lintFindings"] = lintConfig(resp, files)
+
+		if s.Policy != nil {
+			attrMap["policyViolations"] = s.Policy.evaluate(resp, files)
+		}
+
+		attrMap["resolvedPaths"] = resolvePaths(resp, files, resolver)
+
+		attrMap["modules"] = listModules(versionInfo.BuildProfile, resp, files, resolver)
+
+		ingress := isIngressNginx(stdout)
+		servers := listServers(resp, files, instanceID, ingress, s.KubernetesCluster)
+
+		attrMap["ingressNginx"] = ingress
+		linkedItemRequests = append(linkedItemRequests, serverLinks(itemContext, servers)...)
+
+		cisReport := cisBenchmark(resp, files, versionInfo.ConfigArgs)
+
+		attrMap["cisReport"] = cisReport
+		attrMap["cisReportMarkdown"] = cisReport.Markdown()
+
+		if paths := certificatePaths(resp, resolver); len(paths) > 0 {
+			certs, certErrs := s.readCertificates(itemContext, instance, paths)
+
+			var certList []CertificateInfo
+
+			for _, path := range paths {
+				if cert, ok := certs[path]; ok {
+					certList = append(certList, cert)
+				}
+			}
+
+			collectionErrors = append(collectionErrors, certErrs...)
+
+			attrMap["certificates"] = certList
+			attrMap["certificateMismatches"] = findCertificateMismatches(resp, certs, resolver)
+			linkedItemRequests = append(linkedItemRequests, certificateLinks(itemContext, certList)...)
+		}
+
+		if len(files) > 0 {
+			status, collectionErr := s.checkReload(itemContext, instance, pidPath(resp, versionInfo.BuildProfile, resolver), files.Paths())
+
+			if collectionErr != nil {
+				collectionErrors = append(collectionErrors, *collectionErr)
+			} else {
+				attrMap["pendingReload"] = status.PendingReload()
+				attrMap["lastReload"] = status.LastReload
+				attrMap["changedSinceReload"] = status.ChangedSinceReload
+			}
+		}
+	}
+
+	// Partial results are flagged in the attributes rather than the item's
+	// metadata since the engine replaces the metadata, and it has nowhere to
+	// record errors
+	attrMap["collectionErrors"] = collectionErrors
+	attrMap["partial"] = len(collectionErrors) > 0
+
+	attributes, err := sdp.ToAttributes(attrMap)
+
+	if err != nil {
+		return nil, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: fmt.Sprintf("error converting to attributes: %v", err),
 			Context:     itemContext,
 		}
 	}
+
+	item := sdp.Item{
+		Type:               "nginx",
+		UniqueAttribute:    "instance",
+		Attributes:         attributes,
+		Context:            itemContext,
+		LinkedItemRequests: linkedItemRequests,
+	}
+
+	return &item, nil
+}
+
+// advisories Returns the advisories that versions should be checked against
+func (s *NginxSource) advisories() []Advisory {
+	if s.Advisories == nil {
+		return BundledAdvisories
+	}
+
+	return s.Advisories
+}
+
+// runCommand Runs a command using the `command` source in the given context
+func (s *NginxSource) runCommand(itemContext string, command string) ([]*sdp.Item, []*sdp.ItemRequestError, error) {
+	if s.run != nil {
+		return s.run(itemContext, command)
+	}
+
+	return runCommand(s.Engine, itemContext, command)
+}
+
+// runCommand Sends a request for the `command` source to run a command and
+// waits for the result
+func runCommand(engine *discovery.Engine, itemContext string, command string) ([]*sdp.Item, []*sdp.ItemRequestError, error) {
+	commandUUID := uuid.New()
+
+	request := sdp.ItemRequest{
+		Type:            "command",
+		Method:          sdp.RequestMethod_GET,
+		Query:           command,
+		LinkDepth:       0,
+		Context:         itemContext,
+		IgnoreCache:     false,
+		UUID:            commandUUID[:],
+		Timeout:         durationpb.New(10 * time.Second),
+		ItemSubject:     discovery.NewItemSubject(),
+		ResponseSubject: discovery.NewResponseSubject(),
+	}
+
+	progress := sdp.NewRequestProgress(&request)
+
+	return progress.Execute(engine.ManagedConnection())
 }
 
 // Weight Returns the priority weighting of items returned by this source.
@@ -243,44 +656,61 @@ func (s *NginxSource) Weight() int {
 	return 100
 }
 
-type NginxVersionInfo struct {
-	Version    string
-	BuiltBy    string
-	OpenSSL    string
-	ConfigArgs []string
+// singleItem Returns the item from a command, or the reason it couldn't be
+// gathered. Errors that stopped the command running are reported as
+// CollectionErrorFailed, and a missing item as CollectionErrorNotFound
+func singleItem(command string, items []*sdp.Item, errs []*sdp.ItemRequestError, err error) (*sdp.Item, *CollectionError) {
+	if err != nil {
+		return nil, &CollectionError{
+			Command: command,
+			Type:    CollectionErrorFailed,
+			Error:   err.Error(),
+		}
+	}
+
+	if len(items) != 1 {
+		return nil, &CollectionError{
+			Command: command,
+			Type:    CollectionErrorNotFound,
+			Error:   fmt.Sprintf("expected 1 item but got %v. Errors: %v", len(items), errs),
+		}
+	}
+
+	return items[0], nil
 }
 
-var versionRegex = regexp.MustCompile(`nginx version:\s+(\S+)`)
-var builtByRegex = regexp.MustCompile(`built by\s+(.*)`)
-var opensslRegex = regexp.MustCompile(`built with OpenSSL\s+(\S+)`)
-var configArgsRegex = regexp.MustCompile(`configure arguments: (.*)`)
-var eachArgRegex = regexp.MustCompile(`(-(\S+'.*?'|\S+)\s??)`)
+// hashConfig Returns the base64 encoded SHA1 of the config output
+func hashConfig(config string) string {
+	shaSum := sha1.Sum([]byte(config))
 
-// parseVersionInfo Parses version information from `nginx -V`
-func parseVersionInfo(infoString string) NginxVersionInfo {
-	versionInfo := NginxVersionInfo{}
+	return base64.URLEncoding.EncodeToString(shaSum[:])
+}
 
-	if matches := versionRegex.FindStringSubmatch(infoString); len(matches) == 2 {
-		versionInfo.Version = matches[1]
-	}
+// commandExitCode Returns the exit code of an item from the `command` source
+func commandExitCode(item *sdp.Item) (int, error) {
+	exitCode, err := item.Attributes.Get("exitCode")
 
-	if matches := builtByRegex.FindStringSubmatch(infoString); len(matches) == 2 {
-		versionInfo.BuiltBy = matches[1]
+	if err != nil {
+		return 0, err
 	}
 
-	if matches := opensslRegex.FindStringSubmatch(infoString); len(matches) == 2 {
-		versionInfo.OpenSSL = matches[1]
+	f, err := strconv.ParseFloat(fmt.Sprint(exitCode), 64)
+
+	if err != nil {
+		return 0, err
 	}
 
-	if matches := configArgsRegex.FindStringSubmatch(infoString); len(matches) == 2 {
-		if argMatches := eachArgRegex.FindAllStringSubmatch(matches[1], -1); len(argMatches) > 0 {
-			for _, thisArg := range argMatches {
-				if len(thisArg) >= 2 {
-					versionInfo.ConfigArgs = append(versionInfo.ConfigArgs, thisArg[1])
-				}
-			}
-		}
+	return int(f), nil
+}
+
+// commandOutput Returns the stdout or stderr of an item from the `command`
+// source, or an empty string if it wasn't set
+func commandOutput(item *sdp.Item, name string) string {
+	output, err := item.Attributes.Get(name)
+
+	if err != nil || output == nil {
+		return ""
 	}
 
-	return versionInfo
+	return fmt.Sprint(output)
 }
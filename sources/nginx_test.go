@@ -3,6 +3,8 @@ package sources
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
 	"testing"
 
@@ -22,6 +24,19 @@ type TestNginxCommandSource struct {
 	// run
 	ConfigItem  *sdp.Item
 	ConfigError error
+
+	// The item and error that should be returned when the nginx -t command is
+	// run
+	TestItem  *sdp.Item
+	TestError error
+
+	// The stdout of any other commands, keyed by a regex that matches the
+	// command
+	Outputs map[string]string
+
+	// The stderr of commands that exit with an error, keyed by a regex that
+	// matches the command
+	Failures map[string]string
 }
 
 func (s *TestNginxCommandSource) Type() string {
@@ -47,6 +62,51 @@ func (s *TestNginxCommandSource) Get(ctx context.Context, itemContext string, qu
 	if matched, _ := regexp.MatchString(`nginx -T`, query); matched {
 		return s.ConfigItem, s.ConfigError
 	}
+	if matched, _ := regexp.MatchString(`nginx -t`, query); matched {
+		return s.TestItem, s.TestError
+	}
+
+	for pattern, stderr := range s.Failures {
+		if matched, _ := regexp.MatchString(pattern, query); matched {
+			attributes, err := sdp.ToAttributes(map[string]interface{}{
+				"exitCode": 1,
+				"name":     query,
+				"stderr":   stderr,
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			return &sdp.Item{
+				Type:            "command",
+				UniqueAttribute: "name",
+				Attributes:      attributes,
+				Context:         itemContext,
+			}, nil
+		}
+	}
+
+	for pattern, stdout := range s.Outputs {
+		if matched, _ := regexp.MatchString(pattern, query); matched {
+			attributes, err := sdp.ToAttributes(map[string]interface{}{
+				"exitCode": 0,
+				"name":     query,
+				"stdout":   stdout,
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			return &sdp.Item{
+				Type:            "command",
+				UniqueAttribute: "name",
+				Attributes:      attributes,
+				Context:         itemContext,
+			}, nil
+		}
+	}
 
 	return nil, nil
 }
@@ -59,19 +119,39 @@ func (s *TestNginxCommandSource) Weight() int {
 	return 10
 }
 
+// Run Runs a command against the source directly rather than over NATS, in
+// the same way as the `run` field of NginxSource
+func (s *TestNginxCommandSource) Run(itemContext string, command string) ([]*sdp.Item, []*sdp.ItemRequestError, error) {
+	item, err := s.Get(context.Background(), itemContext, command)
+
+	if ire, ok := err.(*sdp.ItemRequestError); ok {
+		return []*sdp.Item{}, []*sdp.ItemRequestError{ire}, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if item == nil {
+		return []*sdp.Item{}, nil, nil
+	}
+
+	return []*sdp.Item{item}, nil, nil
+}
+
 // This file contains tests for the ColourNameSource source. It is a good idea
 // to write as many exhaustive tests as possible at this level to ensure that
 // your source responds correctly to certain requests.
 func TestGet(t *testing.T) {
 	tests := []SourceTest{
 		{
-			Name:        "get should fail",
+			Name:        "with an invalid instance",
 			ItemContext: "something.specific",
-			Query:       "irrelevant",
+			Query:       "-c /etc/nginx/nginx.conf",
 			Method:      sdp.RequestMethod_GET,
 			ExpectedError: &ExpectedError{
 				Type:             sdp.ItemRequestError_OTHER,
-				ErrorStringRegex: regexp.MustCompile(`Get is not supported`),
+				ErrorStringRegex: regexp.MustCompile(`invalid instance`),
 				Context:          "something.specific",
 			},
 		},
@@ -80,10 +160,49 @@ func TestGet(t *testing.T) {
 	RunSourceTests(t, tests, &NginxSource{})
 }
 
+func TestGetRegistersInstance(t *testing.T) {
+	commands := &TestNginxCommandSource{
+		VersionItem: testCommandItem(t, "nginx -V", 0, "", "nginx version: nginx/1.20.2\nconfigure arguments: --prefix=/etc/nginx --conf-path=/etc/nginx/nginx.conf\n"),
+	}
+
+	source := &NginxSource{run: commands.Run}
+	id := "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf"
+
+	RunSourceTests(t, []SourceTest{
+		{
+			Name:        "get by instance",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_GET,
+			Query:       id,
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"instance": id,
+					},
+				},
+			},
+		},
+		{
+			Name:        "find returns the instance that was got",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_FIND,
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"instance": id,
+					},
+				},
+			},
+		},
+	}, source)
+}
+
 func TestFind(t *testing.T) {
 	tests := []SourceTest{
 		{
-			Name:          "find returns no items",
+			Name:          "find returns no items before any instances are discovered",
 			ItemContext:   "something.specific",
 			Method:        sdp.RequestMethod_FIND,
 			ExpectedError: nil,
@@ -96,9 +215,122 @@ func TestFind(t *testing.T) {
 	RunSourceTests(t, tests, &NginxSource{})
 }
 
+func TestSearchWithoutTriggerData(t *testing.T) {
+	tests := []SourceTest{
+		{
+			Name:        "with an empty query",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "{}",
+			ExpectedError: &ExpectedError{
+				Type:             sdp.ItemRequestError_OTHER,
+				ErrorStringRegex: regexp.MustCompile(`missing service_data`),
+				Context:          "test",
+			},
+		},
+		{
+			Name:        "with a process trigger without process_data",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       `{"trigger_type": 1}`,
+			ExpectedError: &ExpectedError{
+				Type:             sdp.ItemRequestError_OTHER,
+				ErrorStringRegex: regexp.MustCompile(`missing process_data`),
+				Context:          "test",
+			},
+		},
+	}
+
+	RunSourceTests(t, tests, &NginxSource{})
+}
+
+func TestSearchProcessTrigger(t *testing.T) {
+	query, err := json.Marshal(triggers.TriggerData{
+		TriggerType: triggers.PROCESS,
+		TriggerItemRef: &sdp.Reference{
+			Type:                 "process",
+			UniqueAttributeValue: "1234",
+			Context:              "test",
+		},
+		ProcessData: &triggers.ProcessData{
+			PID:    1234,
+			Binary: "nginx",
+			Args:   []string{"-c", "/etc/nginx/nginx.conf"},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands := &TestNginxCommandSource{
+		VersionItem: testCommandItem(t, "nginx -V", 0, "", "nginx version: nginx/1.20.2\nconfigure arguments: --prefix=/etc/nginx\n"),
+		Outputs: map[string]string{
+			`^readlink /proc/1234/exe$`: "/usr/sbin/nginx\n",
+		},
+	}
+
+	RunSourceTests(t, []SourceTest{
+		{
+			Name:        "with a relative binary",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       string(query),
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"binary":  "/usr/sbin/nginx",
+						"version": "nginx/1.20.2",
+					},
+				},
+			},
+		},
+	}, &NginxSource{run: commands.Run})
+}
+
+func TestSearchByPID(t *testing.T) {
+	commands := &TestNginxCommandSource{
+		VersionItem: testCommandItem(t, "nginx -V", 0, "", "nginx version: nginx/1.20.2\nconfigure arguments: --prefix=/etc/nginx\n"),
+		Outputs: map[string]string{
+			`^sh -c 'for p in 1235; do`: "1234 nginx: worker process \n",
+			`^sh -c 'for p in 1234; do`: "1 nginx: master process /usr/sbin/nginx -c /etc/nginx/nginx.conf \n",
+			`^sh -c 'for p in 99; do`:   "0 /sbin/init \n",
+		},
+	}
+
+	RunSourceTests(t, []SourceTest{
+		{
+			Name:        "by the pid of a worker",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "pid:1235",
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"instance": "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+					},
+				},
+			},
+		},
+		{
+			Name:        "by a pid that isn't nginx",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "pid:99",
+			ExpectedError: &ExpectedError{
+				Type:    sdp.ItemRequestError_NOTFOUND,
+				Context: "test",
+			},
+		},
+	}, &NginxSource{run: commands.Run})
+}
+
 func TestSearch(t *testing.T) {
 	var configAttributes *sdp.ItemAttributes
 	var versionAttributes *sdp.ItemAttributes
+	var testAttributes *sdp.ItemAttributes
 	var err error
 	var queryBytes []byte
 
@@ -124,6 +356,17 @@ func TestSearch(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	testAttributes, err = sdp.ToAttributes(map[string]interface{}{
+		"exitCode": 0,
+		"name":     "/usr/sbin/nginx -t",
+		"stderr":   "nginx: [warn] conflicting server name \"localhost\" on 0.0.0.0:80, ignored\nnginx: the configuration file /etc/nginx/nginx.conf syntax is ok\nnginx: configuration file /etc/nginx/nginx.conf test is successful\n",
+		"stdout":   "",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	trigger := triggers.TriggerData{
 		TriggerType: triggers.SERVICE,
 		TriggerItemRef: &sdp.Reference{
@@ -143,6 +386,61 @@ func TestSearch(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	socketQueryBytes, err := json.Marshal(triggers.TriggerData{
+		TriggerType: triggers.SOCKET,
+		TriggerItemRef: &sdp.Reference{
+			Type:                 "socket",
+			UniqueAttributeValue: "0.0.0.0:80",
+			Context:              "test",
+		},
+		SocketData: &triggers.SocketData{
+			Address: "0.0.0.0",
+			Port:    80,
+			PID:     1235,
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packageQueryBytes, err := json.Marshal(triggers.TriggerData{
+		TriggerType: triggers.PACKAGE,
+		TriggerItemRef: &sdp.Reference{
+			Type:                 "package",
+			UniqueAttributeValue: "nginx",
+			Context:              "test",
+		},
+		PackageData: &triggers.PackageData{
+			Name:     "nginx",
+			Version:  "1.20.2-1~focal",
+			Binary:   "/usr/sbin/nginx",
+			ConfFile: "/etc/nginx/nginx.conf",
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processQueryBytes, err := json.Marshal(triggers.TriggerData{
+		TriggerType: triggers.PROCESS,
+		TriggerItemRef: &sdp.Reference{
+			Type:                 "process",
+			UniqueAttributeValue: "1234",
+			Context:              "test",
+		},
+		ProcessData: &triggers.ProcessData{
+			PID:    1234,
+			Binary: "/usr/sbin/nginx",
+			Args:   []string{"-c", "/etc/nginx/nginx.conf"},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	responderEngine := discovery.Engine{
 		Name:                  "test-responder",
 		MaxParallelExecutions: 1,
@@ -169,6 +467,23 @@ func TestSearch(t *testing.T) {
 			Context:         "test",
 		},
 		ConfigError: nil,
+		TestItem: &sdp.Item{
+			Type:            "command",
+			UniqueAttribute: "name",
+			Attributes:      testAttributes,
+			Context:         "test",
+		},
+		TestError: nil,
+		Outputs: map[string]string{
+			`^sh -c 'pid=\$\(cat /var/run/nginx.pid\)`: "btime 1699900000\nticks 100\n" +
+				"process 1234 (nginx) S 1 1234 1234 0 -1 4194624 100 0 0 0 0 0 0 0 20 0 1 0 1000 10000000 300\n" +
+				"cmdline 1234 nginx: master process /usr/sbin/nginx -c /etc/nginx/nginx.conf \n" +
+				"process 1235 (nginx) S 1234 1234 1234 0 -1 4194624 100 0 0 0 0 0 0 0 20 0 1 0 9640000 10000000 300\n" +
+				"cmdline 1235 nginx: worker process \n" +
+				"mtime 1699990000 /etc/nginx/nginx.conf\nmtime 1600000000 /etc/nginx/mime.types\nmtime 1699999000 /etc/nginx/conf.d/default.conf\n",
+			`^sh -c 'for p in 1235; do`: "1234 nginx: worker process \n",
+			`^sh -c 'for p in 1234; do`: "1 nginx: master process /usr/sbin/nginx -c /etc/nginx/nginx.conf \n",
+		},
 	})
 
 	// Start the responder engine so that it can reply to requests
@@ -199,9 +514,17 @@ func TestSearch(t *testing.T) {
 				NumItems: 1,
 				ExpectedAttributes: []map[string]interface{}{
 					{
-						"version": "nginx/1.20.2",
-						"builtBy": "gcc 9.3.0 (Ubuntu 9.3.0-10ubuntu2) ",
-						"openSSL": "1.1.1f",
+						"version":          "nginx/1.20.2",
+						"product":          "nginx",
+						"coreVersion":      "1.20.2",
+						"sslLibrary":       "OpenSSL",
+						"compiler":         "gcc",
+						"configTest.Valid": true,
+						"configStatus":     "valid",
+						"pendingReload":    true,
+						"instance":         "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+						"builtBy":          "gcc 9.3.0 (Ubuntu 9.3.0-10ubuntu2) ",
+						"openSSL":          "1.1.1f",
 						"configArgs": []interface{}{
 							"--prefix=/etc/nginx",
 							"--sbin-path=/usr/sbin/nginx",
@@ -245,6 +568,108 @@ func TestSearch(t *testing.T) {
 							"--with-cc-opt='-g -O2 -fdebug-prefix-map=/data/builder/debuild/nginx-1.20.2/debian/debuild-base/nginx-1.20.2=. -fstack-protector-strong -Wformat -Werror=format-security -Wp,-D_FORTIFY_SOURCE=2 -fPIC'",
 							"--with-ld-opt='-Wl,-Bsymbolic-functions -Wl,-z,relro -Wl,-z,now -Wl,--as-needed -pie'",
 						},
+						"buildProfile.Prefix":      "/etc/nginx",
+						"buildProfile.ConfPath":    "/etc/nginx/nginx.conf",
+						"buildProfile.ModulesPath": "/usr/lib/nginx/modules",
+						"buildProfile.User":        "nginx",
+						"buildProfile.LDOpt":       "-Wl,-Bsymbolic-functions -Wl,-z,relro -Wl,-z,now -Wl,--as-needed -pie",
+					},
+				},
+			},
+		},
+		{
+			Name:        "with a process trigger",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       string(processQueryBytes),
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"instance": "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+					},
+				},
+			},
+		},
+		{
+			Name:        "with a package trigger",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       string(packageQueryBytes),
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"package.Version": "1.20.2-1~focal",
+						"coreVersion":     "1.20.2",
+					},
+				},
+			},
+		},
+		{
+			Name:        "with a socket trigger",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       string(socketQueryBytes),
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"binary": "/usr/sbin/nginx",
+					},
+				},
+			},
+		},
+		{
+			Name:        "with an invalid query",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "pid:1234 port:443",
+			ExpectedError: &ExpectedError{
+				Type:             sdp.ItemRequestError_OTHER,
+				ErrorStringRegex: regexp.MustCompile(`exactly one`),
+				Context:          "test",
+			},
+		},
+		{
+			Name:        "by the pid of a worker",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "pid:1235",
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"binary":  "/usr/sbin/nginx",
+						"version": "nginx/1.20.2",
+					},
+				},
+			},
+		},
+		{
+			Name:        "get by instance",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_GET,
+			Query:       "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"instance": "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+						"version":  "nginx/1.20.2",
+					},
+				},
+			},
+		},
+		{
+			Name:        "find returns the instance that was searched for",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_FIND,
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"instance": "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
 					},
 				},
 			},
@@ -276,3 +701,183 @@ func TestSearch(t *testing.T) {
 		Engine: &sourceEngine,
 	})
 }
+
+// testCommandItem Returns an item from the `command` source with the given
+// output
+func testCommandItem(t *testing.T, command string, exitCode int, stdout string, stderr string) *sdp.Item {
+	attributes, err := sdp.ToAttributes(map[string]interface{}{
+		"exitCode": exitCode,
+		"name":     command,
+		"stdout":   stdout,
+		"stderr":   stderr,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &sdp.Item{
+		Type:            "command",
+		UniqueAttribute: "name",
+		Attributes:      attributes,
+		Context:         "test",
+	}
+}
+
+// collectionErrorCommands Returns the commands in the `collectionErrors`
+// attribute of an item
+func collectionErrorCommands(t *testing.T, item *sdp.Item) []string {
+	value, err := item.Attributes.Get("collectionErrors")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+
+	list, _ := value.([]interface{})
+
+	for _, e := range list {
+		if m, ok := e.(map[string]interface{}); ok {
+			commands = append(commands, fmt.Sprint(m["Command"]))
+		}
+	}
+
+	return commands
+}
+
+func TestCollect(t *testing.T) {
+	instance := NginxInstance{
+		Binary: "/usr/sbin/nginx",
+		Args:   NginxArgs{ConfFile: "/etc/nginx/nginx.conf"},
+	}
+
+	versionStderr := "nginx version: nginx/1.20.2\nconfigure arguments: --prefix=/etc/nginx --conf-path=/etc/nginx/nginx.conf --pid-path=/var/run/nginx.pid\n"
+
+	t.Run("when the config command fails", func(t *testing.T) {
+		commands := &TestNginxCommandSource{
+			VersionItem: testCommandItem(t, "nginx -V", 0, "", versionStderr),
+			ConfigError: &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_OTHER,
+				ErrorString: "timeout",
+				Context:     "test",
+			},
+			TestItem: testCommandItem(t, "nginx -t", 0, "", "nginx: configuration file /etc/nginx/nginx.conf test is successful\n"),
+		}
+
+		source := NginxSource{run: commands.Run}
+		item, err := source.collect(context.Background(), "test", instance)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		RunItemValidationTest(t, item)
+
+		for key, expected := range map[string]interface{}{
+			"version":          "nginx/1.20.2",
+			"configTest.Valid": true,
+			"partial":          true,
+		} {
+			if value, err := item.Attributes.Get(key); err != nil || value != expected {
+				t.Errorf("expected %v to be %v, got %v (%v)", key, expected, value, err)
+			}
+		}
+
+		if _, err := item.Attributes.Get("config"); err == nil {
+			t.Error("expected config not to be set")
+		}
+
+		if commands := collectionErrorCommands(t, item); len(commands) != 1 || commands[0] != instance.Command("-Tq") {
+			t.Errorf("expected only %v to have failed, got %v", instance.Command("-Tq"), commands)
+		}
+	})
+
+	t.Run("when the version command fails", func(t *testing.T) {
+		config := "# configuration file /opt/nginx/nginx.conf:\nevents {}\n"
+		commands := &TestNginxCommandSource{
+			VersionError: errors.New("timeout"),
+			ConfigItem:   testCommandItem(t, "nginx -Tq", 0, config, ""),
+		}
+
+		// Without the build profile only the paths that were given as
+		// arguments are known
+		withPrefix := NginxInstance{
+			Binary: "/opt/nginx/sbin/nginx",
+			Args:   NginxArgs{ConfFile: "/opt/nginx/nginx.conf", Globals: "daemon off;"},
+		}
+
+		source := NginxSource{run: commands.Run}
+		item, err := source.collect(context.Background(), "test", withPrefix)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id := item.UniqueAttributeValue(); id != "/opt/nginx/sbin/nginx -c /opt/nginx/nginx.conf" {
+			t.Errorf("unexpected instance %v", id)
+		}
+
+		if commands := collectionErrorCommands(t, item); len(commands) == 0 || commands[0] != withPrefix.Command("-V") {
+			t.Errorf("expected %v to have failed, got %v", withPrefix.Command("-V"), commands)
+		}
+
+		if _, err := item.Attributes.Get("version"); err == nil {
+			t.Error("expected version not to be set")
+		}
+	})
+
+	t.Run("when every command fails", func(t *testing.T) {
+		source := NginxSource{run: (&TestNginxCommandSource{}).Run}
+
+		_, err := source.collect(context.Background(), "test", instance)
+
+		if ire, ok := err.(*sdp.ItemRequestError); !ok || ire.ErrorType != sdp.ItemRequestError_NOTFOUND {
+			t.Errorf("expected a NOTFOUND error, got %v", err)
+		}
+	})
+}
+
+func TestCommandOutput(t *testing.T) {
+	attributes, err := sdp.ToAttributes(map[string]interface{}{
+		"exitCode": 1,
+		"name":     "nginx -Tq",
+		"stderr":   "nginx: [emerg] unknown directive \"sever\" in /etc/nginx/conf.d/default.conf:1\nnginx: configuration file /etc/nginx/nginx.conf test failed\n",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := &sdp.Item{Attributes: attributes}
+
+	if exitCode, err := commandExitCode(item); err != nil || exitCode != 1 {
+		t.Errorf("expected exit code 1, got %v (%v)", exitCode, err)
+	}
+
+	if stdout := commandOutput(item, "stdout"); stdout != "" {
+		t.Errorf("expected empty stdout, got %v", stdout)
+	}
+
+	configErrors := parseConfigTest(1, commandOutput(item, "stderr")).Messages
+
+	if len(configErrors) != 1 || configErrors[0].File != "/etc/nginx/conf.d/default.conf" {
+		t.Errorf("unexpected config errors %+v", configErrors)
+	}
+}
+
+func TestSingleItem(t *testing.T) {
+	item := &sdp.Item{Type: "command"}
+
+	if i, collectionErr := singleItem("nginx -V", []*sdp.Item{item}, nil, nil); i != item || collectionErr != nil {
+		t.Errorf("expected the item to be returned, got %v, %v", i, collectionErr)
+	}
+
+	if _, collectionErr := singleItem("nginx -V", nil, nil, errors.New("timeout")); collectionErr == nil || collectionErr.Type != CollectionErrorFailed {
+		t.Errorf("expected a failed collection error, got %v", collectionErr)
+	}
+
+	if _, collectionErr := singleItem("nginx -V", []*sdp.Item{}, nil, nil); collectionErr == nil || collectionErr.Type != CollectionErrorNotFound || collectionErr.Command != "nginx -V" {
+		t.Errorf("expected a not found collection error, got %v", collectionErr)
+	}
+}
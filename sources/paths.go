@@ -0,0 +1,160 @@
+package sources
+
+import (
+	"path"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// defaultPrefix The prefix nginx uses if it wasn't built with `--prefix`
+const defaultPrefix = "/usr/local/nginx"
+
+// pathResolver Resolves relative paths in the config the same way that nginx
+// does. Most paths are relative to the prefix, but files such as includes and
+// certificates are relative to the directory containing the main config file.
+// The zero value leaves paths unchanged
+type pathResolver struct {
+	Prefix     string
+	ConfPrefix string
+
+	// The path to the main config file
+	ConfFile string
+}
+
+// newPathResolver Returns a resolver for an instance. `-p` takes precedence
+// over `--prefix`, and `-c` over `--conf-path`, with relative config paths
+// being relative to the prefix
+func newPathResolver(args NginxArgs, profile NginxBuildProfile) pathResolver {
+	prefix := args.Prefix
+
+	if prefix == "" {
+		prefix = profile.Prefix
+	}
+
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	confPath := args.ConfFile
+
+	if confPath == "" {
+		confPath = profile.ConfPath
+	}
+
+	if confPath == "" {
+		confPath = "conf/nginx.conf"
+	}
+
+	if !path.IsAbs(confPath) {
+		confPath = path.Join(prefix, confPath)
+	}
+
+	return pathResolver{
+		Prefix:     prefix,
+		ConfPrefix: path.Dir(confPath),
+		ConfFile:   confPath,
+	}
+}
+
+// Resolve Returns the absolute path. If conf is true the path is resolved
+// against the config directory, otherwise the prefix
+func (r pathResolver) Resolve(p string, conf bool) string {
+	base := r.Prefix
+
+	if conf {
+		base = r.ConfPrefix
+	}
+
+	if p == "" || path.IsAbs(p) || base == "" {
+		return p
+	}
+
+	return path.Join(base, p)
+}
+
+// pathDirectives Directives with a path as their first argument, and whether
+// that path is relative to the config directory rather than the prefix
+var pathDirectives = map[string]bool{
+	"include":                 true,
+	"ssl_certificate":         true,
+	"ssl_certificate_key":     true,
+	"ssl_trusted_certificate": true,
+	"ssl_client_certificate":  true,
+	"ssl_crl":                 true,
+	"ssl_dhparam":             true,
+	"ssl_password_file":       true,
+	"ssl_session_ticket_key":  true,
+	"ssl_stapling_file":       true,
+	"auth_basic_user_file":    true,
+	"root":                    false,
+	"alias":                   false,
+	"load_module":             false,
+	"pid":                     false,
+	"lock_file":               false,
+	"error_log":               false,
+	"access_log":              false,
+	"client_body_temp_path":   false,
+	"proxy_temp_path":         false,
+	"fastcgi_temp_path":       false,
+	"uwsgi_temp_path":         false,
+	"scgi_temp_path":          false,
+	"proxy_cache_path":        false,
+	"fastcgi_cache_path":      false,
+	"uwsgi_cache_path":        false,
+	"scgi_cache_path":         false,
+}
+
+// ResolvedPath A path from the config along with the absolute path it
+// refers to
+type ResolvedPath struct {
+	Directive string
+	Path      string
+	Resolved  string
+	File      string
+	Line      int
+}
+
+// isFilePath Returns whether a directive argument refers to a file on disk.
+// Paths containing variables and special values such as `off`, `stderr` or
+// `syslog:` destinations can't be resolved
+func isFilePath(p string) bool {
+	switch {
+	case p == "", p == "off", p == "stderr":
+		return false
+	case strings.Contains(p, "$"):
+		return false
+	case strings.HasPrefix(p, "syslog:"), strings.HasPrefix(p, "memory:"), strings.HasPrefix(p, "data:"):
+		return false
+	}
+
+	return true
+}
+
+// resolvePaths Returns every path-like argument in the config along with the
+// absolute path it resolves to
+func resolvePaths(resp crossplane.Response, files configFileMap, resolver pathResolver) []ResolvedPath {
+	var paths []ResolvedPath
+
+	root, files := combineConfigs(resp, files)
+
+	crossplane.Walk(root.Block, func(d crossplane.Directive, parents []crossplane.Directive) {
+		conf, ok := pathDirectives[d.Directive]
+
+		if !ok || len(d.Args) == 0 || !isFilePath(d.Args[0]) {
+			return
+		}
+
+		file, line := files.Locate(d.Line)
+
+		paths = append(paths, ResolvedPath{
+			Directive: d.Directive,
+			Path:      d.Args[0],
+			Resolved:  resolver.Resolve(d.Args[0], conf),
+			File:      file,
+			Line:      line,
+		})
+	})
+
+	return paths
+}
@@ -0,0 +1,88 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+func TestNewPathResolver(t *testing.T) {
+	profile := NginxBuildProfile{
+		Prefix:   "/etc/nginx",
+		ConfPath: "/etc/nginx/nginx.conf",
+	}
+
+	tests := []struct {
+		Name       string
+		Args       NginxArgs
+		Profile    NginxBuildProfile
+		Prefix     string
+		ConfPrefix string
+	}{
+		{"from the build profile", NginxArgs{}, profile, "/etc/nginx", "/etc/nginx"},
+		{"with -p", NginxArgs{Prefix: "/srv/nginx"}, profile, "/srv/nginx", "/etc/nginx"},
+		{"with a relative -c", NginxArgs{Prefix: "/srv/nginx", ConfFile: "conf/app.conf"}, profile, "/srv/nginx", "/srv/nginx/conf"},
+		{"with nothing set", NginxArgs{}, NginxBuildProfile{}, "/usr/local/nginx", "/usr/local/nginx/conf"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			r := newPathResolver(test.Args, test.Profile)
+
+			if r.Prefix != test.Prefix {
+				t.Errorf("expected prefix %v, got %v", test.Prefix, r.Prefix)
+			}
+
+			if r.ConfPrefix != test.ConfPrefix {
+				t.Errorf("expected conf prefix %v, got %v", test.ConfPrefix, r.ConfPrefix)
+			}
+		})
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				Parsed: []crossplane.Directive{
+					{Directive: "include", Args: []string{"mime.types"}, Line: 2},
+					{Directive: "error_log", Args: []string{"stderr"}, Line: 3},
+					{
+						Directive: "server",
+						Line:      4,
+						Block: []crossplane.Directive{
+							{Directive: "root", Args: []string{"html"}, Line: 5},
+							{Directive: "ssl_certificate", Args: []string{"certs/example.pem"}, Line: 6},
+							{Directive: "ssl_certificate_key", Args: []string{"/etc/ssl/private/example.key"}, Line: 7},
+							{Directive: "access_log", Args: []string{"logs/$host.log"}, Line: 8},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	resolver := pathResolver{Prefix: "/srv/nginx", ConfPrefix: "/srv/nginx/conf"}
+	paths := resolvePaths(resp, configFileMap{{Path: "/srv/nginx/conf/nginx.conf"}}, resolver)
+
+	expected := []ResolvedPath{
+		{Directive: "include", Path: "mime.types", Resolved: "/srv/nginx/conf/mime.types", File: "/srv/nginx/conf/nginx.conf", Line: 2},
+		{Directive: "root", Path: "html", Resolved: "/srv/nginx/html", File: "/srv/nginx/conf/nginx.conf", Line: 5},
+		{Directive: "ssl_certificate", Path: "certs/example.pem", Resolved: "/srv/nginx/conf/certs/example.pem", File: "/srv/nginx/conf/nginx.conf", Line: 6},
+		{Directive: "ssl_certificate_key", Path: "/etc/ssl/private/example.key", Resolved: "/etc/ssl/private/example.key", File: "/srv/nginx/conf/nginx.conf", Line: 7},
+	}
+
+	if len(paths) != len(expected) {
+		t.Fatalf("expected %v paths, got %v", len(expected), paths)
+	}
+
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], paths[i])
+		}
+	}
+
+	if certs := certificatePaths(resp, resolver); len(certs) != 1 || certs[0] != "/srv/nginx/conf/certs/example.pem" {
+		t.Errorf("expected the certificate path to be resolved, got %v", certs)
+	}
+}
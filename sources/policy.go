@@ -0,0 +1,368 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/spf13/viper"
+)
+
+// Policy A set of user-defined rules that configs are checked against
+type Policy struct {
+	Rules []PolicyRule `mapstructure:"rules"`
+}
+
+// PolicyRule A single rule e.g. "every server on 443 must set HSTS"
+type PolicyRule struct {
+	Name        string `mapstructure:"name"`
+	Description string `mapstructure:"description"`
+	Severity    string `mapstructure:"severity"`
+
+	// The block directive that the rule applies to e.g. `server` or
+	// `location`. If this is empty the rule is applied to the config as a whole
+	Scope string `mapstructure:"scope"`
+
+	// Conditions that must all match within a block for the rule to apply to
+	// it. If there are none the rule applies to every block in the scope
+	When []PolicyCondition `mapstructure:"when"`
+
+	// Conditions that must all match within the block
+	Require []PolicyCondition `mapstructure:"require"`
+
+	// Conditions that must not match anywhere within the block
+	Forbid []PolicyCondition `mapstructure:"forbid"`
+}
+
+// PolicyCondition Matches directives within a block
+type PolicyCondition struct {
+	// The name of the directive
+	Directive string `mapstructure:"directive"`
+
+	// A regex that the directive's arguments, joined with spaces, must match.
+	// If this is empty all arguments match
+	Args string `mapstructure:"args"`
+
+	// If set, the directive's first argument is treated as a URL and only
+	// matches if its host isn't an IP within one of these CIDR ranges. Hosts
+	// that refer to an upstream block match if any of its servers do
+	OutsideNetworks []string `mapstructure:"outside_networks"`
+
+	// Whether directives in nested blocks also match. By default only the
+	// directives directly within the block are checked, since nginx only
+	// inherits directives downwards e.g. an `add_header` in a location doesn't
+	// apply to its server. Required directives can also be inherited from the
+	// blocks around it, see inherited. Rules without a scope always check the
+	// whole config
+	Descendants bool `mapstructure:"descendants"`
+
+	argsRegex *regexp.Regexp
+	networks  []*net.IPNet
+}
+
+// PolicyViolation A place in the config where a rule was broken
+type PolicyViolation struct {
+	Rule     string
+	Severity string
+	Message  string
+	File     string
+	Line     int
+}
+
+// LoadPolicy Loads policy rules from a YAML (or any other format supported by
+// viper) file
+func LoadPolicy(path string) (*Policy, error) {
+	var policy Policy
+
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	if err := v.Unmarshal(&policy); err != nil {
+		return nil, err
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %v has no name", i)
+		}
+
+		for _, conditions := range [][]PolicyCondition{rule.When, rule.Require, rule.Forbid} {
+			for j := range conditions {
+				if err := conditions[j].compile(); err != nil {
+					return nil, fmt.Errorf("rule %v: %v", rule.Name, err)
+				}
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// compile Validates the condition and compiles its regex and networks
+func (c *PolicyCondition) compile() error {
+	var err error
+
+	if c.Directive == "" {
+		return fmt.Errorf("condition has no directive")
+	}
+
+	if c.Args != "" {
+		c.argsRegex, err = regexp.Compile(c.Args)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	c.networks = nil
+
+	for _, cidr := range c.OutsideNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			return err
+		}
+
+		c.networks = append(c.networks, network)
+	}
+
+	return nil
+}
+
+// String Describes the condition for use in messages
+func (c PolicyCondition) String() string {
+	s := c.Directive
+
+	if c.Args != "" {
+		s += fmt.Sprintf(" matching %v", c.Args)
+	}
+
+	if len(c.OutsideNetworks) > 0 {
+		s += fmt.Sprintf(" outside %v", strings.Join(c.OutsideNetworks, ", "))
+	}
+
+	return s
+}
+
+// matches Returns the directives within the block that match the condition.
+// If descendants is true directives in nested blocks are included
+func (c PolicyCondition) matches(block crossplane.Directive, descendants bool, upstreams map[string][]string) []crossplane.Directive {
+	var matched []crossplane.Directive
+
+	candidates := block.Children(c.Directive)
+
+	if descendants || c.Descendants {
+		candidates = block.Descendants(c.Directive)
+	}
+
+	for _, d := range candidates {
+		if c.argsRegex != nil && !c.argsRegex.MatchString(strings.Join(d.Args, " ")) {
+			continue
+		}
+
+		if len(c.networks) > 0 && (len(d.Args) == 0 || !c.outside(d.Args[0], upstreams)) {
+			continue
+		}
+
+		matched = append(matched, d)
+	}
+
+	return matched
+}
+
+// inherited Returns the directives that match the condition and apply to the
+// block because it inherits them from the blocks that enclose it. nginx only
+// inherits a directive if the block doesn't set it itself, so the nearest
+// block that sets the directive decides e.g. a server with an `add_header` of
+// its own doesn't get any of the headers from its http block
+func (c PolicyCondition) inherited(block crossplane.Directive, parents []crossplane.Directive, upstreams map[string][]string) []crossplane.Directive {
+	if len(block.Children(c.Directive)) > 0 {
+		return nil
+	}
+
+	for i := len(parents) - 1; i >= 0; i-- {
+		if len(parents[i].Children(c.Directive)) > 0 {
+			return c.matches(parents[i], false, upstreams)
+		}
+	}
+
+	return nil
+}
+
+// outside Returns whether the host of the URL is outside the condition's
+// networks. Hostnames that can't be resolved to an upstream are considered to
+// be outside since we can't tell where they point
+func (c PolicyCondition) outside(url string, upstreams map[string][]string) bool {
+	host := proxySchemeRegex.ReplaceAllString(url, "")
+
+	if strings.HasPrefix(host, "unix:") {
+		return false
+	}
+
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	if servers, ok := upstreams[host]; ok {
+		for _, server := range servers {
+			if c.outside(server, nil) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+
+	if ip == nil {
+		return true
+	}
+
+	for _, network := range c.networks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// EvaluateFile Parses a config file, which can be either a normal nginx config
+// or the output of `nginx -T`, and checks it against the policy
+func (p *Policy) EvaluateFile(ctx context.Context, path string) ([]PolicyViolation, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := crossplane.ParseFile(ctx, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.evaluate(resp, splitConfigFiles(string(content))), nil
+}
+
+// evaluate Checks the parsed config against every rule in the policy
+func (p *Policy) evaluate(resp crossplane.Response, files configFileMap) []PolicyViolation {
+	var violations []PolicyViolation
+
+	// The whole config as a single block, used for rules without a scope and
+	// to look up upstreams
+	root, files := combineConfigs(resp, files)
+
+	upstreams := make(map[string][]string)
+
+	for _, upstream := range root.Descendants("upstream") {
+		if len(upstream.Args) == 0 {
+			continue
+		}
+
+		for _, server := range upstream.Children("server") {
+			if len(server.Args) > 0 {
+				upstreams[upstream.Args[0]] = append(upstreams[upstream.Args[0]], server.Args[0])
+			}
+		}
+	}
+
+	for _, rule := range p.Rules {
+		blocks := []crossplane.Directive{root}
+		blockParents := [][]crossplane.Directive{nil}
+
+		// The whole config is a single block so its conditions have to match
+		// anywhere within it
+		descendants := rule.Scope == ""
+
+		if rule.Scope != "" {
+			blocks = nil
+			blockParents = nil
+
+			crossplane.Walk(root.Block, func(d crossplane.Directive, parents []crossplane.Directive) {
+				if d.Directive == rule.Scope && len(d.Block) > 0 {
+					blocks = append(blocks, d)
+					blockParents = append(blockParents, parents)
+				}
+			})
+		}
+
+		for i, block := range blocks {
+			applies := true
+
+			for _, condition := range rule.When {
+				if len(condition.matches(block, descendants, upstreams)) == 0 {
+					applies = false
+					break
+				}
+			}
+
+			if !applies {
+				continue
+			}
+
+			for _, condition := range rule.Require {
+				if len(condition.matches(block, descendants, upstreams)) == 0 && len(condition.inherited(block, blockParents[i], upstreams)) == 0 {
+					file, line := files.Locate(block.Line)
+
+					violations = append(violations, PolicyViolation{
+						Rule:     rule.Name,
+						Severity: rule.Severity,
+						Message:  rule.message(fmt.Sprintf("%v block is missing %v", scopeName(rule.Scope), condition)),
+						File:     file,
+						Line:     line,
+					})
+				}
+			}
+
+			for _, condition := range rule.Forbid {
+				for _, d := range condition.matches(block, descendants, upstreams) {
+					file, line := files.Locate(d.Line)
+
+					violations = append(violations, PolicyViolation{
+						Rule:     rule.Name,
+						Severity: rule.Severity,
+						Message:  rule.message(fmt.Sprintf("%v %v is not allowed", d.Directive, strings.Join(d.Args, " "))),
+						File:     file,
+						Line:     line,
+					})
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+// message Prefixes the details of a violation with the rule's description
+func (r PolicyRule) message(detail string) string {
+	if r.Description == "" {
+		return detail
+	}
+
+	return fmt.Sprintf("%v: %v", r.Description, detail)
+}
+
+// scopeName Returns a name for the scope to be used in messages
+func scopeName(scope string) string {
+	if scope == "" {
+		return "config"
+	}
+
+	return scope
+}
@@ -0,0 +1,251 @@
+package sources
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+const testPolicy = `
+rules:
+  - name: hsts
+    description: Every server on 443 must set HSTS
+    severity: high
+    scope: server
+    when:
+      - directive: listen
+        args: '\b443\b'
+    require:
+      - directive: add_header
+        args: '^Strict-Transport-Security '
+  - name: internal-upstreams
+    description: No proxy_pass to plain http outside 10.0.0.0/8
+    severity: medium
+    forbid:
+      - directive: proxy_pass
+        args: '^http://'
+        outside_networks:
+          - 10.0.0.0/8
+  - name: no-autoindex
+    severity: low
+    scope: server
+    forbid:
+      - directive: autoindex
+        args: '^on$'
+        descendants: true
+`
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("with a valid file", func(t *testing.T) {
+		file := path.Join(dir, "policy.yaml")
+
+		if err := os.WriteFile(file, []byte(testPolicy), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		policy, err := LoadPolicy(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(policy.Rules) != 3 {
+			t.Fatalf("expected 3 rules, got %v", len(policy.Rules))
+		}
+
+		if networks := policy.Rules[1].Forbid[0].networks; len(networks) != 1 {
+			t.Errorf("expected networks to be compiled, got %v", networks)
+		}
+	})
+
+	t.Run("with an invalid regex", func(t *testing.T) {
+		file := path.Join(dir, "invalid.yaml")
+		content := "rules:\n  - name: bad\n    require:\n      - directive: listen\n        args: '('\n"
+
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadPolicy(file); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	file := path.Join(t.TempDir(), "policy.yaml")
+
+	if err := os.WriteFile(file, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/etc/nginx/nginx.conf",
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "upstream",
+						Args:      []string{"internal"},
+						Line:      1,
+						Block: []crossplane.Directive{
+							{Directive: "server", Args: []string{"10.0.0.1:8080"}, Line: 2},
+						},
+					},
+					{
+						Directive: "upstream",
+						Args:      []string{"external"},
+						Line:      4,
+						Block: []crossplane.Directive{
+							{Directive: "server", Args: []string{"192.168.0.1:8080"}, Line: 5},
+						},
+					},
+				},
+			},
+			{
+				File: "/etc/nginx/conf.d/default.conf",
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "server",
+						Line:      1,
+						Block: []crossplane.Directive{
+							{Directive: "listen", Args: []string{"443", "ssl"}, Line: 2},
+							{Directive: "add_header", Args: []string{"Strict-Transport-Security", "max-age=31536000"}, Line: 3},
+							{Directive: "location", Args: []string{"/a"}, Line: 4, Block: []crossplane.Directive{
+								{Directive: "proxy_pass", Args: []string{"http://10.1.2.3:8080"}, Line: 5},
+							}},
+							{Directive: "location", Args: []string{"/b"}, Line: 7, Block: []crossplane.Directive{
+								{Directive: "proxy_pass", Args: []string{"http://internal"}, Line: 8},
+							}},
+							{Directive: "location", Args: []string{"/c"}, Line: 10, Block: []crossplane.Directive{
+								{Directive: "proxy_pass", Args: []string{"https://example.com"}, Line: 11},
+								{Directive: "autoindex", Args: []string{"on"}, Line: 12},
+							}},
+						},
+					},
+					{
+						Directive: "server",
+						Line:      14,
+						Block: []crossplane.Directive{
+							{Directive: "listen", Args: []string{"[::]:443", "ssl"}, Line: 15},
+							{Directive: "location", Args: []string{"/"}, Line: 16, Block: []crossplane.Directive{
+								{Directive: "proxy_pass", Args: []string{"http://external"}, Line: 17},
+							}},
+						},
+					},
+					{
+						Directive: "server",
+						Line:      20,
+						Block: []crossplane.Directive{
+							{Directive: "listen", Args: []string{"80"}, Line: 21},
+							{Directive: "proxy_pass", Args: []string{"http://example.com"}, Line: 22},
+						},
+					},
+					{
+						// HSTS is only set in a location so doesn't apply to
+						// the server as a whole
+						Directive: "server",
+						Line:      25,
+						Block: []crossplane.Directive{
+							{Directive: "listen", Args: []string{"443", "ssl"}, Line: 26},
+							{Directive: "location", Args: []string{"/"}, Line: 27, Block: []crossplane.Directive{
+								{Directive: "add_header", Args: []string{"Strict-Transport-Security", "max-age=31536000"}, Line: 28},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	violations := policy.evaluate(resp, nil)
+
+	expected := []struct {
+		Rule string
+		File string
+		Line int
+	}{
+		{"hsts", "/etc/nginx/conf.d/default.conf", 14},
+		{"hsts", "/etc/nginx/conf.d/default.conf", 25},
+		{"internal-upstreams", "/etc/nginx/conf.d/default.conf", 17},
+		{"internal-upstreams", "/etc/nginx/conf.d/default.conf", 22},
+		{"no-autoindex", "/etc/nginx/conf.d/default.conf", 12},
+	}
+
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %v violations, got %v: %+v", len(expected), len(violations), violations)
+	}
+
+	for i, e := range expected {
+		v := violations[i]
+
+		if v.Rule != e.Rule || v.File != e.File || v.Line != e.Line {
+			t.Errorf("expected violation %v to be %v at %v:%v, got %+v", i, e.Rule, e.File, e.Line, v)
+		}
+	}
+}
+
+func TestPolicyEvaluateInherited(t *testing.T) {
+	file := path.Join(t.TempDir(), "policy.yaml")
+
+	if err := os.WriteFile(file, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/etc/nginx/nginx.conf",
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "http",
+						Line:      1,
+						Block: []crossplane.Directive{
+							{Directive: "add_header", Args: []string{"Strict-Transport-Security", "max-age=31536000"}, Line: 2},
+							{
+								// Inherits HSTS from http
+								Directive: "server",
+								Line:      3,
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"443", "ssl"}, Line: 4},
+								},
+							},
+							{
+								// Setting any add_header stops the http
+								// block's headers from being inherited
+								Directive: "server",
+								Line:      6,
+								Block: []crossplane.Directive{
+									{Directive: "listen", Args: []string{"443", "ssl"}, Line: 7},
+									{Directive: "add_header", Args: []string{"X-Frame-Options", "DENY"}, Line: 8},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	violations := policy.evaluate(resp, nil)
+
+	if len(violations) != 1 || violations[0].Rule != "hsts" || violations[0].Line != 6 {
+		t.Errorf("expected only the server that sets its own headers to be missing HSTS, got %+v", violations)
+	}
+}
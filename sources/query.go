@@ -0,0 +1,238 @@
+package sources
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/triggers"
+	"github.com/overmindtech/sdp-go"
+)
+
+// InstanceQuery A Search query that identifies an instance directly rather
+// than through a trigger. Queries are made up of space-separated `key:value`
+// pairs, with values quoted if they contain spaces:
+//
+// * `binary:/usr/sbin/nginx conf:/etc/nginx/nginx.conf prefix:/etc/nginx`:
+// The binary and optionally its config file and prefix
+// * `pid:1234`: The nginx process with the given pid, either the master or
+// one of its workers
+// * `port:443`: The nginx listening on a TCP port
+type InstanceQuery struct {
+	Binary string
+	Conf   string
+	Prefix string
+	PID    int
+	Port   int
+}
+
+// parseInstanceQuery Parses a query. Only one of the binary, pid and port
+// forms can be used at once
+func parseInstanceQuery(query string) (InstanceQuery, error) {
+	var q InstanceQuery
+
+	words, err := shellSplit(query)
+
+	if err != nil {
+		return q, err
+	}
+
+	if len(words) == 0 {
+		return q, fmt.Errorf("empty query")
+	}
+
+	for _, word := range words {
+		key, value, found := strings.Cut(word, ":")
+
+		if !found || value == "" {
+			return q, fmt.Errorf("invalid query %q, expected key:value", word)
+		}
+
+		switch key {
+		case "binary":
+			q.Binary = value
+		case "conf":
+			q.Conf = value
+		case "prefix":
+			q.Prefix = value
+		case "pid", "port":
+			n, err := strconv.Atoi(value)
+
+			if err != nil || n <= 0 {
+				return q, fmt.Errorf("invalid %v %q", key, value)
+			}
+
+			if key == "pid" {
+				q.PID = n
+			} else {
+				q.Port = n
+			}
+		default:
+			return q, fmt.Errorf("unknown query key %q", key)
+		}
+	}
+
+	forms := 0
+
+	for _, used := range []bool{q.Binary != "" || q.Conf != "" || q.Prefix != "", q.PID != 0, q.Port != 0} {
+		if used {
+			forms++
+		}
+	}
+
+	if forms != 1 {
+		return q, fmt.Errorf("query must use exactly one of binary/conf/prefix, pid or port")
+	}
+
+	return q, nil
+}
+
+// resolveInstanceQuery Finds the instance that a query refers to. Pids and
+// ports are resolved to the master process using `ss` and `/proc`
+func (s *NginxSource) resolveInstanceQuery(itemContext string, q InstanceQuery) (NginxInstance, error) {
+	if q.PID == 0 && q.Port == 0 {
+		return NginxInstance{
+			Binary: q.Binary,
+			Args: NginxArgs{
+				ConfFile: q.Conf,
+				Prefix:   q.Prefix,
+			},
+		}, nil
+	}
+
+	var pids []int
+
+	if q.Port != 0 {
+		command := fmt.Sprintf("ss -Hltnp 'sport = :%v'", q.Port)
+		output, collectionErr := s.commandStdout(itemContext, command)
+
+		if collectionErr != nil {
+			return NginxInstance{}, fmt.Errorf("%v: %v", command, collectionErr.Error)
+		}
+
+		if pids = parseSocketPIDs(output); len(pids) == 0 {
+			return NginxInstance{}, &sdp.ItemRequestError{
+				ErrorType:   sdp.ItemRequestError_NOTFOUND,
+				ErrorString: fmt.Sprintf("no nginx process is listening on port %v", q.Port),
+				Context:     itemContext,
+			}
+		}
+	} else {
+		pids = []int{q.PID}
+	}
+
+	// The first lookup finds the processes themselves. If they are workers a
+	// second lookup finds their master using the parent pid
+	for lookup := 0; lookup < 2 && len(pids) > 0; lookup++ {
+		command := "sh -c " + shellQuote(processScript(pids))
+		output, collectionErr := s.commandStdout(itemContext, command)
+
+		if collectionErr != nil {
+			return NginxInstance{}, fmt.Errorf("%v: %v", command, collectionErr.Error)
+		}
+
+		processes := parseProcesses(output)
+		pids = nil
+
+		for _, p := range processes {
+			if triggers.IsMasterProcess(p.Args) {
+				data, err := triggers.ParseMasterProcess(p.Args)
+
+				if err != nil {
+					return NginxInstance{}, err
+				}
+
+				return NginxInstance{
+					Binary: data.Binary,
+					Args:   parseNginxArgs(data.Args),
+				}, nil
+			}
+
+			if strings.HasPrefix(p.Args, "nginx: ") {
+				pids = append(pids, p.PPID)
+			}
+		}
+	}
+
+	return NginxInstance{}, &sdp.ItemRequestError{
+		ErrorType:   sdp.ItemRequestError_NOTFOUND,
+		ErrorString: fmt.Sprintf("no nginx master process found for query %+v", q),
+		Context:     itemContext,
+	}
+}
+
+// processScript Returns a shell script that prints the parent pid and
+// command line of each process that exists, in the same form as `ps -o
+// ppid=,args=`. This reads `/proc` since the `ps` in busybox has no `-p`
+func processScript(pids []int) string {
+	return strings.Join([]string{
+		fmt.Sprintf("for p in %v; do", joinPIDs(pids)),
+		`[ -r /proc/$p/cmdline ] || continue;`,
+		`echo "$(sed -n 's/^PPid:[[:space:]]*//p' /proc/$p/status) $(tr '\0' ' ' < /proc/$p/cmdline)";`,
+		"done; exit 0",
+	}, " ")
+}
+
+// process A process from the output of processScript
+type process struct {
+	PPID int
+	Args string
+}
+
+// parseProcesses Parses the output of processScript
+func parseProcesses(output string) []process {
+	var processes []process
+
+	for _, line := range strings.Split(output, "\n") {
+		ppid, args, found := strings.Cut(strings.TrimSpace(line), " ")
+
+		if !found {
+			continue
+		}
+
+		n, err := strconv.Atoi(ppid)
+
+		if err != nil {
+			continue
+		}
+
+		processes = append(processes, process{PPID: n, Args: strings.TrimSpace(args)})
+	}
+
+	return processes
+}
+
+// joinPIDs Returns the pids separated by spaces
+func joinPIDs(pids []int) string {
+	pidStrings := make([]string, len(pids))
+
+	for i, pid := range pids {
+		pidStrings[i] = strconv.Itoa(pid)
+	}
+
+	return strings.Join(pidStrings, " ")
+}
+
+var socketPIDRegex = regexp.MustCompile(`\("nginx",pid=(\d+),`)
+
+// parseSocketPIDs Returns the pids of the nginx processes from the output of
+// `ss -p`, in the form `users:(("nginx",pid=1235,fd=6),("nginx",pid=1234,fd=6))`
+func parseSocketPIDs(output string) []int {
+	var pids []int
+
+	seen := make(map[int]bool)
+
+	for _, matches := range socketPIDRegex.FindAllStringSubmatch(output, -1) {
+		pid, err := strconv.Atoi(matches[1])
+
+		if err != nil || seen[pid] {
+			continue
+		}
+
+		seen[pid] = true
+		pids = append(pids, pid)
+	}
+
+	return pids
+}
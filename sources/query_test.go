@@ -0,0 +1,80 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseInstanceQuery(t *testing.T) {
+	tests := map[string]InstanceQuery{
+		"binary:/usr/sbin/nginx":                            {Binary: "/usr/sbin/nginx"},
+		"binary:/usr/sbin/nginx conf:/etc/nginx/nginx.conf": {Binary: "/usr/sbin/nginx", Conf: "/etc/nginx/nginx.conf"},
+		"'prefix:/opt/my nginx' conf:/opt/app/nginx.conf":   {Prefix: "/opt/my nginx", Conf: "/opt/app/nginx.conf"},
+		"pid:1234": {PID: 1234},
+		"port:443": {Port: 443},
+	}
+
+	for query, expected := range tests {
+		q, err := parseInstanceQuery(query)
+
+		if err != nil {
+			t.Errorf("%q: %v", query, err)
+			continue
+		}
+
+		if q != expected {
+			t.Errorf("%q: expected %+v, got %+v", query, expected, q)
+		}
+	}
+
+	for _, invalid := range []string{"", "/usr/sbin/nginx", "pid:abc", "port:-1", "user:nginx", "pid:1234 port:443", "binary:nginx pid:1"} {
+		if _, err := parseInstanceQuery(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestParseSocketPIDs(t *testing.T) {
+	output := `LISTEN 0      511          0.0.0.0:443        0.0.0.0:*    users:(("nginx",pid=1236,fd=6),("nginx",pid=1235,fd=6),("nginx",pid=1234,fd=6))
+LISTEN 0      511             [::]:443           [::]:*    users:(("nginx",pid=1236,fd=7),("nginx",pid=1235,fd=7),("nginx",pid=1234,fd=7))
+`
+
+	pids := parseSocketPIDs(output)
+
+	if len(pids) != 3 || pids[0] != 1236 || pids[2] != 1234 {
+		t.Errorf("unexpected pids %v", pids)
+	}
+
+	if pids := parseSocketPIDs(`LISTEN 0 4096 0.0.0.0:443 0.0.0.0:* users:(("haproxy",pid=99,fd=5))`); len(pids) != 0 {
+		t.Errorf("expected no nginx pids, got %v", pids)
+	}
+}
+
+func TestProcessScript(t *testing.T) {
+	script := processScript([]int{1234, 1235})
+
+	if !strings.HasPrefix(script, "for p in 1234 1235; do") {
+		t.Errorf("expected the script to loop over the pids, got %v", script)
+	}
+
+	// busybox's ps has no -p, so the processes are read from /proc
+	if strings.Contains(script, "ps ") || !strings.Contains(script, "/proc/$p/cmdline") {
+		t.Errorf("expected the script to read /proc rather than use ps, got %v", script)
+	}
+}
+
+func TestParseProcesses(t *testing.T) {
+	processes := parseProcesses("   1 nginx: master process /usr/sbin/nginx\n1234 nginx: worker process\n\n")
+
+	if len(processes) != 2 {
+		t.Fatalf("expected 2 processes, got %+v", processes)
+	}
+
+	if processes[0].PPID != 1 || processes[0].Args != "nginx: master process /usr/sbin/nginx" {
+		t.Errorf("unexpected process %+v", processes[0])
+	}
+
+	if processes[1].PPID != 1234 || processes[1].Args != "nginx: worker process" {
+		t.Errorf("unexpected process %+v", processes[1])
+	}
+}
@@ -0,0 +1,102 @@
+package sources
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+// DefaultInstanceTTL How long an instance is remembered after it was last
+// seen if NginxSource.InstanceTTL isn't set
+const DefaultInstanceTTL = 24 * time.Hour
+
+// knownInstance An instance that has been discovered, along with the context
+// it was found in and when it was last collected successfully
+type knownInstance struct {
+	Context  string
+	Instance NginxInstance
+	LastSeen time.Time
+}
+
+// instanceRegistry The instances that have been discovered by triggers,
+// searches or gets, so that they can be returned by Find. The zero value is
+// ready to use
+type instanceRegistry struct {
+	mutex     sync.Mutex
+	instances map[string]map[string]knownInstance
+}
+
+// Add Records that an instance was seen in a context. Instances are keyed by
+// their ID so seeing the same instance again only updates when it was seen
+func (r *instanceRegistry) Add(itemContext string, id string, instance NginxInstance, seen time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.instances == nil {
+		r.instances = make(map[string]map[string]knownInstance)
+	}
+
+	if r.instances[itemContext] == nil {
+		r.instances[itemContext] = make(map[string]knownInstance)
+	}
+
+	r.instances[itemContext][id] = knownInstance{
+		Context:  itemContext,
+		Instance: instance,
+		LastSeen: seen,
+	}
+}
+
+// Lookup Returns the instance with the given ID in a context, if it has been
+// seen. Expired instances are still returned since they are only removed by
+// List
+func (r *instanceRegistry) Lookup(itemContext string, id string) (NginxInstance, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	known, ok := r.instances[itemContext][id]
+
+	return known.Instance, ok
+}
+
+// List Returns the instances in a context that were seen within the TTL,
+// removing any that have expired. The wildcard context returns instances from
+// all contexts
+func (r *instanceRegistry) List(itemContext string, ttl time.Duration, now time.Time) []knownInstance {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var instances []knownInstance
+
+	for c, byID := range r.instances {
+		if itemContext != sdp.WILDCARD && itemContext != c {
+			continue
+		}
+
+		for id, known := range byID {
+			if now.Sub(known.LastSeen) > ttl {
+				delete(byID, id)
+				continue
+			}
+
+			instances = append(instances, known)
+		}
+
+		if len(byID) == 0 {
+			delete(r.instances, c)
+		}
+	}
+
+	// Sort so that results are consistent between calls
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Context != instances[j].Context {
+			return instances[i].Context < instances[j].Context
+		}
+
+		return instances[i].Instance.Command() < instances[j].Instance.Command()
+	})
+
+	return instances
+}
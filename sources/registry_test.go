@@ -0,0 +1,47 @@
+package sources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestInstanceRegistry(t *testing.T) {
+	var r instanceRegistry
+
+	now := time.Now()
+	web := NginxInstance{Binary: "/usr/sbin/nginx", Args: NginxArgs{ConfFile: "/etc/nginx/nginx.conf"}}
+	app := NginxInstance{Binary: "/usr/sbin/nginx", Args: NginxArgs{ConfFile: "/opt/app/nginx.conf"}}
+
+	r.Add("host1", "web", web, now.Add(-2*time.Hour))
+	r.Add("host1", "app", app, now)
+	r.Add("host2", "web", web, now)
+
+	if instance, found := r.Lookup("host1", "app"); !found || instance != app {
+		t.Errorf("expected to look up the app instance, got %+v", instance)
+	}
+
+	if _, found := r.Lookup("host3", "app"); found {
+		t.Error("expected instances not to be found in other contexts")
+	}
+
+	if instances := r.List("host1", time.Hour, now); len(instances) != 1 || instances[0].Instance != app {
+		t.Errorf("expected only the unexpired instance, got %+v", instances)
+	}
+
+	// Seeing the expired instance again should bring it back
+	r.Add("host1", "web", web, now)
+
+	if instances := r.List("host1", time.Hour, now); len(instances) != 2 {
+		t.Errorf("expected 2 instances, got %+v", instances)
+	}
+
+	if instances := r.List(sdp.WILDCARD, time.Hour, now); len(instances) != 3 || instances[2].Context != "host2" {
+		t.Errorf("expected instances from all contexts, got %+v", instances)
+	}
+
+	if instances := r.List("host3", time.Hour, now); len(instances) != 0 {
+		t.Errorf("expected no instances, got %+v", instances)
+	}
+}
@@ -0,0 +1,290 @@
+package sources
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/sdp-go"
+)
+
+// ReloadStatus Whether the config on disk has changed since nginx last loaded
+// it. `nginx -T` reads the files on disk, so if they have been changed without
+// a reload the config that is reported isn't what is running
+type ReloadStatus struct {
+	// When the running config was loaded. All workers are replaced on every
+	// reload, whereas a worker that crashes is replaced on its own, so this
+	// is the start time of the oldest worker. If there are no workers this
+	// is the start time of the master process
+	LastReload time.Time
+
+	// Config files that have been modified since the last reload
+	ChangedSinceReload []string
+}
+
+// PendingReload Returns whether any files have changed since the last reload
+func (r ReloadStatus) PendingReload() bool {
+	return len(r.ChangedSinceReload) > 0
+}
+
+// pidPath Returns the path to the pid file, from the `pid` directive or
+// `--pid-path` if it isn't set
+func pidPath(resp crossplane.Response, profile NginxBuildProfile, resolver pathResolver) string {
+	root, _ := combineConfigs(resp, nil)
+
+	for _, d := range root.Children("pid") {
+		if len(d.Args) > 0 {
+			return resolver.Resolve(d.Args[0], false)
+		}
+	}
+
+	if profile.PidPath != "" {
+		return resolver.Resolve(profile.PidPath, false)
+	}
+
+	return resolver.Resolve("logs/nginx.pid", false)
+}
+
+// Paths Returns the paths of all files in the map
+func (m configFileMap) Paths() []string {
+	paths := make([]string, len(m))
+
+	for i, f := range m {
+		paths[i] = f.Path
+	}
+
+	return paths
+}
+
+// checkReload Compares the time that the running config was loaded against
+// the modification times of the config files. Everything is gathered in a
+// single script run wherever the instance runs, see reloadScript
+func (s *NginxSource) checkReload(itemContext string, instance NginxInstance, pidFile string, files []string) (ReloadStatus, *CollectionError) {
+	command := instance.Exec("sh -c " + shellQuote(reloadScript(pidFile, files)))
+	items, errs, err := s.runCommand(itemContext, command)
+	item, collectionErr := singleItem(command, items, errs, err)
+
+	if collectionErr != nil {
+		return ReloadStatus{}, collectionErr
+	}
+
+	if exitCode, err := commandExitCode(item); err == nil && exitCode != 0 {
+		return ReloadStatus{}, &CollectionError{
+			Command: command,
+			Type:    CollectionErrorFailed,
+			Error:   fmt.Sprintf("exit code %v: %v", exitCode, strings.TrimSpace(commandOutput(item, "stderr"))),
+		}
+	}
+
+	status, err := parseReloadOutput(commandOutput(item, "stdout"), files)
+
+	if err != nil {
+		return ReloadStatus{}, &CollectionError{Command: command, Type: CollectionErrorFailed, Error: err.Error()}
+	}
+
+	return status, nil
+}
+
+// reloadScript Returns a shell script that prints the boot time, the clock
+// ticks per second, the `/proc/<pid>/stat` and command line of the master
+// process and its children, and the modification time of each file. This
+// only uses `/proc` and commands that busybox has, since the `ps` in alpine
+// images has neither `etimes` nor `--ppid`
+func reloadScript(pidFile string, files []string) string {
+	quotedFiles := make([]string, len(files))
+
+	for i, f := range files {
+		quotedFiles[i] = shellQuote(f)
+	}
+
+	return strings.Join([]string{
+		fmt.Sprintf("pid=$(cat %v) || exit 1", shellQuote(pidFile)),
+		"grep '^btime ' /proc/stat",
+		`echo "ticks $(getconf CLK_TCK 2>/dev/null)"`,
+		`for s in /proc/$pid/status $(grep -l "^PPid:[[:space:]]*$pid\$" /proc/[0-9]*/status 2>/dev/null); do ` +
+			`p=${s#/proc/}; p=${p%/status}; ` +
+			`echo "process $(cat /proc/$p/stat 2>/dev/null)"; ` +
+			`echo "cmdline $p $(tr '\0' ' ' < /proc/$p/cmdline 2>/dev/null)"; ` +
+			"done",
+		fmt.Sprintf("stat -c 'mtime %%Y %%n' %v 2>/dev/null", strings.Join(quotedFiles, " ")),
+		"exit 0",
+	}, "; ")
+}
+
+// defaultClockTicks The number of clock ticks per second, used if `getconf`
+// isn't available. This is 100 on all common Linux architectures
+const defaultClockTicks = 100
+
+// parseReloadOutput Parses the output of reloadScript. The first process is
+// the master and the rest are its children
+func parseReloadOutput(output string, files []string) (ReloadStatus, error) {
+	var bootTime int64
+	var modTimes strings.Builder
+
+	ticks := int64(defaultClockTicks)
+	masterPID := 0
+	starts := make(map[int]int64)
+	cmdlines := make(map[int]string)
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+		switch key {
+		case "btime":
+			bootTime, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		case "ticks":
+			if t, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && t > 0 {
+				ticks = t
+			}
+		case "process":
+			pid, start, err := parseProcStat(value)
+
+			if err != nil {
+				continue
+			}
+
+			if masterPID == 0 {
+				masterPID = pid
+			}
+
+			starts[pid] = start
+		case "cmdline":
+			pid, cmdline, _ := strings.Cut(value, " ")
+
+			if p, err := strconv.Atoi(pid); err == nil {
+				cmdlines[p] = strings.TrimSpace(cmdline)
+			}
+		case "mtime":
+			modTimes.WriteString(value + "\n")
+		}
+	}
+
+	if bootTime == 0 {
+		return ReloadStatus{}, fmt.Errorf("boot time not found in /proc/stat")
+	}
+
+	if masterPID == 0 {
+		return ReloadStatus{}, fmt.Errorf("master process not found")
+	}
+
+	lastReload := starts[masterPID]
+	oldestWorker := int64(-1)
+
+	for pid, start := range starts {
+		// Workers from before the last reload finish their requests before
+		// exiting
+		if pid == masterPID || strings.Contains(cmdlines[pid], "shutting down") {
+			continue
+		}
+
+		if oldestWorker < 0 || start < oldestWorker {
+			oldestWorker = start
+		}
+	}
+
+	if oldestWorker > lastReload {
+		lastReload = oldestWorker
+	}
+
+	return reloadStatus(time.Unix(bootTime+lastReload/ticks, 0), parseModTimes(modTimes.String()), files), nil
+}
+
+// parseProcStat Returns the pid and start time in clock ticks since boot from
+// the contents of `/proc/<pid>/stat`. The command name is in brackets and can
+// contain spaces, so the other fields are counted from the last bracket
+func parseProcStat(stat string) (int, int64, error) {
+	nameStart := strings.Index(stat, "(")
+	nameEnd := strings.LastIndex(stat, ")")
+
+	if nameStart < 0 || nameEnd < nameStart {
+		return 0, 0, fmt.Errorf("invalid stat %q", stat)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:nameStart]))
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid pid in stat %q", stat)
+	}
+
+	// The fields after the command name start at the state, which is field
+	// 3, and the start time is field 22
+	fields := strings.Fields(stat[nameEnd+1:])
+
+	if len(fields) < 20 {
+		return 0, 0, fmt.Errorf("invalid stat %q", stat)
+	}
+
+	start, err := strconv.ParseInt(fields[19], 10, 64)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start time in stat %q", stat)
+	}
+
+	return pid, start, nil
+}
+
+// commandStdout Runs a command and returns its stdout
+func (s *NginxSource) commandStdout(itemContext string, command string) (string, *CollectionError) {
+	items, errs, err := s.runCommand(itemContext, command)
+
+	return singleStdout(command, items, errs, err)
+}
+
+// singleStdout Returns the stdout of the item from a command, or the reason
+// it couldn't be gathered. Commands that exit with an error are failures
+// since their stdout can't be relied on
+func singleStdout(command string, items []*sdp.Item, errs []*sdp.ItemRequestError, err error) (string, *CollectionError) {
+	item, collectionErr := singleItem(command, items, errs, err)
+
+	if collectionErr != nil {
+		return "", collectionErr
+	}
+
+	if exitCode, err := commandExitCode(item); err == nil && exitCode != 0 {
+		return "", &CollectionError{
+			Command: command,
+			Type:    CollectionErrorFailed,
+			Error:   fmt.Sprintf("exit code %v: %v", exitCode, strings.TrimSpace(commandOutput(item, "stderr"))),
+		}
+	}
+
+	return commandOutput(item, "stdout"), nil
+}
+
+// parseModTimes Parses the output of `stat -c '%Y %n'` into the modification
+// time of each file
+func parseModTimes(output string) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+
+	for _, line := range strings.Split(output, "\n") {
+		seconds, name, found := strings.Cut(strings.TrimSpace(line), " ")
+
+		if !found {
+			continue
+		}
+
+		if t, err := strconv.ParseInt(seconds, 10, 64); err == nil {
+			modTimes[name] = time.Unix(t, 0)
+		}
+	}
+
+	return modTimes
+}
+
+// reloadStatus Returns the files that were modified after the last reload,
+// in the order that they appear in the config
+func reloadStatus(lastReload time.Time, modTimes map[string]time.Time, files []string) ReloadStatus {
+	status := ReloadStatus{
+		LastReload: lastReload,
+	}
+
+	for _, f := range files {
+		if modTime, ok := modTimes[f]; ok && modTime.After(lastReload) {
+			status.ChangedSinceReload = append(status.ChangedSinceReload, f)
+		}
+	}
+
+	return status
+}
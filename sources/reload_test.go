@@ -0,0 +1,147 @@
+package sources
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+)
+
+// testProcStat Returns the contents of `/proc/<pid>/stat` for a process that
+// started the given number of clock ticks after boot
+func testProcStat(pid int, comm string, ppid int, start int) string {
+	return fmt.Sprintf("%v (%v) S %v %v %v 0 -1 4194624 100 0 0 0 0 0 0 0 20 0 1 0 %v 10000000 300 18446744073709551615", pid, comm, ppid, pid, pid, start)
+}
+
+func TestParseProcStat(t *testing.T) {
+	pid, start, err := parseProcStat(testProcStat(1234, "nginx: (master)", 1, 500))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pid != 1234 || start != 500 {
+		t.Errorf("expected pid 1234 started at 500, got %v at %v", pid, start)
+	}
+
+	if _, _, err := parseProcStat("1234 (nginx) S 1"); err == nil {
+		t.Error("expected an error for a truncated stat")
+	}
+}
+
+func TestParseReloadOutput(t *testing.T) {
+	files := []string{"/etc/nginx/nginx.conf", "/etc/nginx/conf.d/default.conf"}
+
+	// Booted at 1699900000, master started at +1000s and reloaded at
+	// +90000s. One worker crashed and was respawned later, one from before
+	// the reload is still shutting down, and the cache loader has exited
+	output := strings.Join([]string{
+		"btime 1699900000",
+		"ticks ",
+		"process " + testProcStat(1234, "nginx", 1, 100000),
+		"cmdline 1234 nginx: master process /usr/sbin/nginx -c /etc/nginx/nginx.conf ",
+		"process " + testProcStat(1300, "nginx", 1234, 5000000),
+		"cmdline 1300 nginx: worker process is shutting down ",
+		"process " + testProcStat(1400, "nginx", 1234, 9000000),
+		"cmdline 1400 nginx: worker process ",
+		"process " + testProcStat(1500, "nginx", 1234, 9900000),
+		"cmdline 1500 nginx: worker process ",
+		"process ",
+		"cmdline 1501 ",
+		"mtime 1699989000 /etc/nginx/nginx.conf",
+		"mtime 1699999000 /etc/nginx/conf.d/default.conf",
+	}, "\n")
+
+	status, err := parseReloadOutput(output, files)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := time.Unix(1699990000, 0); !status.LastReload.Equal(expected) {
+		t.Errorf("expected last reload at %v, got %v", expected, status.LastReload)
+	}
+
+	if len(status.ChangedSinceReload) != 1 || status.ChangedSinceReload[0] != "/etc/nginx/conf.d/default.conf" {
+		t.Errorf("unexpected changed files %v", status.ChangedSinceReload)
+	}
+
+	t.Run("without workers", func(t *testing.T) {
+		status, err := parseReloadOutput("btime 1699900000\nticks 1000\nprocess "+testProcStat(1234, "nginx", 1, 1000000), files)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := time.Unix(1699901000, 0); !status.LastReload.Equal(expected) {
+			t.Errorf("expected the master's start time %v, got %v", expected, status.LastReload)
+		}
+	})
+
+	t.Run("without a master process", func(t *testing.T) {
+		if _, err := parseReloadOutput("btime 1699900000\nticks 100\nprocess \n", files); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestReloadScript(t *testing.T) {
+	script := reloadScript("/run/nginx.pid", []string{"/etc/nginx/conf.d/my app.conf"})
+
+	for _, expected := range []string{"cat /run/nginx.pid", "/proc/stat", "'/etc/nginx/conf.d/my app.conf'"} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q, got %v", expected, script)
+		}
+	}
+
+	// The script is run inside containers so it can't use ps, which busybox
+	// doesn't support the options of
+	if strings.Contains(script, "ps ") {
+		t.Errorf("expected script not to use ps, got %v", script)
+	}
+}
+
+func TestReloadStatus(t *testing.T) {
+	modTimes := parseModTimes("1699990000 /etc/nginx/nginx.conf\n1699999000 /etc/nginx/conf.d/my app.conf\n")
+	files := []string{"/etc/nginx/nginx.conf", "/etc/nginx/conf.d/my app.conf", "/etc/nginx/missing.conf"}
+
+	status := reloadStatus(time.Unix(1699996400, 0), modTimes, files)
+
+	if !status.PendingReload() {
+		t.Error("expected a pending reload")
+	}
+
+	if len(status.ChangedSinceReload) != 1 || status.ChangedSinceReload[0] != "/etc/nginx/conf.d/my app.conf" {
+		t.Errorf("unexpected changed files %v", status.ChangedSinceReload)
+	}
+
+	status = reloadStatus(time.Unix(1700000000, 0), modTimes, files)
+
+	if status.PendingReload() {
+		t.Errorf("expected no pending reload, got %v", status.ChangedSinceReload)
+	}
+}
+
+func TestPidPath(t *testing.T) {
+	resolver := pathResolver{Prefix: "/srv/nginx", ConfPrefix: "/srv/nginx/conf"}
+
+	withDirective := crossplane.Response{
+		Config: []crossplane.Config{
+			{Parsed: []crossplane.Directive{{Directive: "pid", Args: []string{"run/nginx.pid"}, Line: 1}}},
+		},
+	}
+
+	if p := pidPath(withDirective, NginxBuildProfile{PidPath: "/var/run/nginx.pid"}, resolver); p != "/srv/nginx/run/nginx.pid" {
+		t.Errorf("expected the pid directive to be used, got %v", p)
+	}
+
+	if p := pidPath(crossplane.Response{}, NginxBuildProfile{PidPath: "/var/run/nginx.pid"}, resolver); p != "/var/run/nginx.pid" {
+		t.Errorf("expected --pid-path to be used, got %v", p)
+	}
+
+	if p := pidPath(crossplane.Response{}, NginxBuildProfile{}, resolver); p != "/srv/nginx/logs/nginx.pid" {
+		t.Errorf("expected the default pid path, got %v", p)
+	}
+}
@@ -0,0 +1,508 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/sdp-go"
+)
+
+// NginxServer A server block from the http context of an instance's config
+type NginxServer struct {
+	// The ID of the instance that the server belongs to
+	Instance string
+
+	ServerNames []string
+	Listen      []string
+	File        string
+	Line        int
+	Locations   []NginxLocation
+
+	// The listening sockets that the server accepts connections on, if they
+	// are known
+	Sockets []*sdp.Reference
+}
+
+// NginxLocation A location block within a server, including nested
+// locations
+type NginxLocation struct {
+	// The ID of the instance and the key of the server that the location
+	// belongs to
+	Instance string
+	Server   string
+
+	// The arguments of the location e.g. `/api/` or `~ \.php$`
+	Path      string
+	ProxyPass string
+	File      string
+	Line      int
+
+	// The Kubernetes objects that the location was generated from, if the
+	// instance is an ingress-nginx controller
+	Ingress *IngressBackend
+}
+
+// Label Returns the first server name and the port of the first listen
+// address e.g. `example.com:443`. A server without a name is labelled `_`
+func (s NginxServer) Label() string {
+	name := "_"
+
+	if len(s.ServerNames) > 0 && s.ServerNames[0] != "" {
+		name = s.ServerNames[0]
+	}
+
+	listen := "80"
+
+	if len(s.Listen) > 0 {
+		listen = s.Listen[0]
+	}
+
+	return fmt.Sprintf("%v:%v", name, listenPort(listen))
+}
+
+// Key Returns the label followed by the file and line of the server block
+// e.g. `example.com:443 /etc/nginx/conf.d/default.conf:3`. Labels aren't
+// unique since servers can listen on the same port on different addresses,
+// or have no name, but only one server block starts on each line
+func (s NginxServer) Key() string {
+	return fmt.Sprintf("%v %v:%v", s.Label(), s.File, s.Line)
+}
+
+// Name Returns the unique name of the server, which is its key followed by the
+// instance e.g. `example.com:443 /etc/nginx/conf.d/default.conf:3@/usr/sbin/nginx
+// -p /etc/nginx -c /etc/nginx/nginx.conf`
+func (s NginxServer) Name() string {
+	return fmt.Sprintf("%v@%v", s.Key(), s.Instance)
+}
+
+// Name Returns the unique name of the location, which is the key of its
+// server and its path followed by the instance e.g. `example.com:443
+// /etc/nginx/conf.d/default.conf:3 /api/@/usr/sbin/nginx -p /etc/nginx -c
+// /etc/nginx/nginx.conf`
+func (l NginxLocation) Name() string {
+	return fmt.Sprintf("%v %v@%v", l.Server, l.Path, l.Instance)
+}
+
+// listenPort Returns the port from the address of a `listen` directive.
+// Unix sockets are returned as-is
+func listenPort(address string) string {
+	if strings.HasPrefix(address, "unix:") {
+		return address
+	}
+
+	_, port := splitListen(address)
+
+	return port
+}
+
+// splitListen Splits the address of a `listen` directive, which can be a
+// port, an address with a port or just an address in which case the port
+// defaults to 80. The host is empty if only a port is given
+func splitListen(address string) (string, string) {
+	if i := strings.LastIndex(address, ":"); i >= 0 && !strings.HasSuffix(address, "]") {
+		return strings.Trim(address[:i], "[]"), address[i+1:]
+	}
+
+	if strings.Trim(address, "0123456789") == "" {
+		return "", address
+	}
+
+	return strings.Trim(address, "[]"), "80"
+}
+
+// Binds Returns whether the server accepts connections on a listening socket.
+// Servers without a host in their `listen` directive bind to all IPv4
+// addresses, and sockets on a wildcard address accept connections for any
+// address in the same family
+func (s NginxServer) Binds(address string, port int) bool {
+	listen := s.Listen
+
+	if len(listen) == 0 {
+		listen = []string{"80"}
+	}
+
+	address = normaliseHost(address)
+
+	for _, l := range listen {
+		host, p := splitListen(l)
+		host = normaliseHost(host)
+
+		if p != strconv.Itoa(port) || isIPv6(host) != isIPv6(address) {
+			continue
+		}
+
+		if host == address || address == "0.0.0.0" || address == "::" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normaliseHost Returns the wildcard address for hosts that mean any IPv4
+// address
+func normaliseHost(host string) string {
+	host = strings.Trim(host, "[]")
+
+	if host == "" || host == "*" {
+		return "0.0.0.0"
+	}
+
+	return host
+}
+
+// isIPv6 Returns whether a host is an IPv6 address
+func isIPv6(host string) bool {
+	return strings.Contains(host, ":")
+}
+
+// linkServerSockets Adds a reference to a listening socket to the links from
+// an `nginx` item to the servers that accept connections on it
+func linkServerSockets(item *sdp.Item, address string, port int, socket *sdp.Reference) {
+	for _, request := range item.LinkedItemRequests {
+		if request.Type != "nginx-server" {
+			continue
+		}
+
+		var server NginxServer
+
+		if err := json.Unmarshal([]byte(request.Query), &server); err != nil || !server.Binds(address, port) {
+			continue
+		}
+
+		server.Sockets = append(server.Sockets, socket)
+
+		if b, err := json.Marshal(server); err == nil {
+			request.Query = string(b)
+		}
+	}
+}
+
+// isHTTPServer Returns whether a directive is a server block in the http
+// context. Servers at the top level are included since they come from a file
+// that was parsed without the http block that includes it, such as a snippet
+// from `conf.d`. Servers in `stream` and `mail` blocks and the servers of an
+// upstream aren't included
+func isHTTPServer(d crossplane.Directive, parents []crossplane.Directive) bool {
+	if d.Directive != "server" || len(d.Block) == 0 {
+		return false
+	}
+
+	return len(parents) == 0 || parents[len(parents)-1].Directive == "http"
+}
+
+// listServers Returns the server blocks from the http context along with
+// their locations. If the config was generated by ingress-nginx the objects
+// that each location came from are included, in the Kubernetes context for the
+// given cluster
+func listServers(resp crossplane.Response, files configFileMap, instance string, ingress bool, cluster string) []NginxServer {
+	var servers []NginxServer
+
+	root, files := combineConfigs(resp, files)
+
+	crossplane.Walk(root.Block, func(d crossplane.Directive, parents []crossplane.Directive) {
+		if !isHTTPServer(d, parents) {
+			return
+		}
+
+		file, line := files.Locate(d.Line)
+
+		server := NginxServer{
+			Instance: instance,
+			File:     file,
+			Line:     line,
+		}
+
+		for _, name := range d.Children("server_name") {
+			server.ServerNames = append(server.ServerNames, name.Args...)
+		}
+
+		for _, listen := range d.Children("listen") {
+			if len(listen.Args) > 0 {
+				server.Listen = append(server.Listen, listen.Args[0])
+			}
+		}
+
+		for _, location := range d.Descendants("location") {
+			file, line := files.Locate(location.Line)
+
+			l := NginxLocation{
+				Instance: instance,
+				Server:   server.Key(),
+				Path:     strings.Join(location.Args, " "),
+				File:     file,
+				Line:     line,
+			}
+
+			if proxyPass := location.Children("proxy_pass"); len(proxyPass) > 0 && len(proxyPass[0].Args) > 0 {
+				l.ProxyPass = proxyPass[0].Args[0]
+			}
+
+			if ingress {
+				l.Ingress = parseIngressBackend(location, cluster)
+			}
+
+			server.Locations = append(server.Locations, l)
+		}
+
+		servers = append(servers, server)
+	})
+
+	return servers
+}
+
+// serverLinks Returns the requests that link an instance to its servers. The
+// server itself is passed in the query since it only exists in the
+// instance's config
+func serverLinks(itemContext string, servers []NginxServer) []*sdp.ItemRequest {
+	var links []*sdp.ItemRequest
+
+	for _, server := range servers {
+		b, err := json.Marshal(server)
+
+		if err != nil {
+			continue
+		}
+
+		links = append(links, &sdp.ItemRequest{
+			Type:    "nginx-server",
+			Method:  sdp.RequestMethod_SEARCH,
+			Query:   string(b),
+			Context: itemContext,
+		})
+	}
+
+	return links
+}
+
+// NginxServerSource Returns the server blocks of nginx instances. These are
+// found by following the links from `nginx` items rather than being
+// collected directly
+type NginxServerSource struct{}
+
+// Type The type of items that this source is capable of finding
+func (s *NginxServerSource) Type() string {
+	return "nginx-server"
+}
+
+// Descriptive name for the source, used in logging and metadata
+func (s *NginxServerSource) Name() string {
+	return "nginx-server-source"
+}
+
+// List of contexts that this source is capable of find items for
+func (s *NginxServerSource) Contexts() []string {
+	return []string{
+		sdp.WILDCARD,
+	}
+}
+
+// Get Servers can't be re-collected on their own, the instance should be
+// collected instead
+func (s *NginxServerSource) Get(ctx context.Context, itemContext string, query string) (*sdp.Item, error) {
+	return nil, &sdp.ItemRequestError{
+		ErrorType:   sdp.ItemRequestError_NOTFOUND,
+		ErrorString: "nginx-server items can only be found using Search",
+		Context:     itemContext,
+	}
+}
+
+// Find Returns nothing for the same reason as Get
+func (s *NginxServerSource) Find(ctx context.Context, itemContext string) ([]*sdp.Item, error) {
+	return []*sdp.Item{}, nil
+}
+
+// Search Returns the server in the query, which is a JSON NginxServer as
+// linked from an `nginx` item
+func (s *NginxServerSource) Search(ctx context.Context, itemContext string, query string) ([]*sdp.Item, error) {
+	var server NginxServer
+
+	err := json.Unmarshal([]byte(query), &server)
+
+	if err != nil {
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: err.Error(),
+			Context:     itemContext,
+		}
+	}
+
+	paths := make([]string, len(server.Locations))
+
+	for i, location := range server.Locations {
+		paths[i] = location.Path
+	}
+
+	attributes, err := sdp.ToAttributes(map[string]interface{}{
+		"name":        server.Name(),
+		"label":       server.Label(),
+		"instance":    server.Instance,
+		"serverNames": server.ServerNames,
+		"listen":      server.Listen,
+		"file":        server.File,
+		"line":        server.Line,
+		"locations":   paths,
+	})
+
+	if err != nil {
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: fmt.Sprintf("error converting to attributes: %v", err),
+			Context:     itemContext,
+		}
+	}
+
+	item := sdp.Item{
+		Type:            "nginx-server",
+		UniqueAttribute: "name",
+		Attributes:      attributes,
+		Context:         itemContext,
+		LinkedItems: append([]*sdp.Reference{
+			{
+				Type:                 "nginx",
+				UniqueAttributeValue: server.Instance,
+				Context:              itemContext,
+			},
+		}, server.Sockets...),
+	}
+
+	backends := make(map[IngressBackend]bool)
+
+	for _, location := range server.Locations {
+		b, err := json.Marshal(location)
+
+		if err != nil {
+			continue
+		}
+
+		item.LinkedItemRequests = append(item.LinkedItemRequests, &sdp.ItemRequest{
+			Type:    "nginx-location",
+			Method:  sdp.RequestMethod_SEARCH,
+			Query:   string(b),
+			Context: itemContext,
+		})
+
+		// Link each ingress and service once, even if they have many paths
+		if location.Ingress != nil {
+			backend := *location.Ingress
+			backend.Path = ""
+
+			if !backends[backend] {
+				backends[backend] = true
+				item.LinkedItemRequests = append(item.LinkedItemRequests, backend.Links()...)
+			}
+		}
+	}
+
+	return []*sdp.Item{&item}, nil
+}
+
+// Weight Returns the priority weighting of items returned by this source
+func (s *NginxServerSource) Weight() int {
+	return 100
+}
+
+// NginxLocationSource Returns the location blocks of nginx servers. These are
+// found by following the links from `nginx-server` items
+type NginxLocationSource struct{}
+
+// Type The type of items that this source is capable of finding
+func (s *NginxLocationSource) Type() string {
+	return "nginx-location"
+}
+
+// Descriptive name for the source, used in logging and metadata
+func (s *NginxLocationSource) Name() string {
+	return "nginx-location-source"
+}
+
+// List of contexts that this source is capable of find items for
+func (s *NginxLocationSource) Contexts() []string {
+	return []string{
+		sdp.WILDCARD,
+	}
+}
+
+// Get Locations can't be re-collected on their own, the instance should be
+// collected instead
+func (s *NginxLocationSource) Get(ctx context.Context, itemContext string, query string) (*sdp.Item, error) {
+	return nil, &sdp.ItemRequestError{
+		ErrorType:   sdp.ItemRequestError_NOTFOUND,
+		ErrorString: "nginx-location items can only be found using Search",
+		Context:     itemContext,
+	}
+}
+
+// Find Returns nothing for the same reason as Get
+func (s *NginxLocationSource) Find(ctx context.Context, itemContext string) ([]*sdp.Item, error) {
+	return []*sdp.Item{}, nil
+}
+
+// Search Returns the location in the query, which is a JSON NginxLocation as
+// linked from an `nginx-server` item
+func (s *NginxLocationSource) Search(ctx context.Context, itemContext string, query string) ([]*sdp.Item, error) {
+	var location NginxLocation
+
+	err := json.Unmarshal([]byte(query), &location)
+
+	if err != nil {
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: err.Error(),
+			Context:     itemContext,
+		}
+	}
+
+	attrMap := map[string]interface{}{
+		"name":      location.Name(),
+		"path":      location.Path,
+		"server":    location.Server,
+		"instance":  location.Instance,
+		"proxyPass": location.ProxyPass,
+		"file":      location.File,
+		"line":      location.Line,
+	}
+
+	if location.Ingress != nil {
+		attrMap["ingress"] = *location.Ingress
+	}
+
+	attributes, err := sdp.ToAttributes(attrMap)
+
+	if err != nil {
+		return []*sdp.Item{}, &sdp.ItemRequestError{
+			ErrorType:   sdp.ItemRequestError_OTHER,
+			ErrorString: fmt.Sprintf("error converting to attributes: %v", err),
+			Context:     itemContext,
+		}
+	}
+
+	item := sdp.Item{
+		Type:            "nginx-location",
+		UniqueAttribute: "name",
+		Attributes:      attributes,
+		Context:         itemContext,
+		LinkedItems: []*sdp.Reference{
+			{
+				Type:                 "nginx-server",
+				UniqueAttributeValue: fmt.Sprintf("%v@%v", location.Server, location.Instance),
+				Context:              itemContext,
+			},
+		},
+	}
+
+	if location.Ingress != nil {
+		item.LinkedItemRequests = location.Ingress.Links()
+	}
+
+	return []*sdp.Item{&item}, nil
+}
+
+// Weight Returns the priority weighting of items returned by this source
+func (s *NginxLocationSource) Weight() int {
+	return 100
+}
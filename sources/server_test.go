@@ -0,0 +1,323 @@
+package sources
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/nginx-source/crossplane"
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestListenPort(t *testing.T) {
+	tests := map[string]string{
+		"443":                  "443",
+		"127.0.0.1:8080":       "8080",
+		"[::]:443":             "443",
+		"[::1]":                "80",
+		"example.com":          "80",
+		"unix:/run/nginx.sock": "unix:/run/nginx.sock",
+	}
+
+	for address, expected := range tests {
+		if port := listenPort(address); port != expected {
+			t.Errorf("expected the port of %v to be %v, got %v", address, expected, port)
+		}
+	}
+}
+
+func TestServerBinds(t *testing.T) {
+	tests := []struct {
+		Listen  []string
+		Address string
+		Port    int
+		Binds   bool
+	}{
+		{nil, "0.0.0.0", 80, true},
+		{[]string{"443"}, "0.0.0.0", 443, true},
+		{[]string{"443"}, "0.0.0.0", 80, false},
+		{[]string{"443"}, "::", 443, false},
+		{[]string{"[::]:443"}, "::", 443, true},
+		{[]string{"127.0.0.1:8080"}, "127.0.0.1", 8080, true},
+		{[]string{"127.0.0.1:8080"}, "0.0.0.0", 8080, true},
+		{[]string{"10.0.0.1:8080"}, "127.0.0.1", 8080, false},
+		{[]string{"unix:/run/nginx.sock"}, "0.0.0.0", 80, false},
+	}
+
+	for _, test := range tests {
+		server := NginxServer{Listen: test.Listen}
+
+		if binds := server.Binds(test.Address, test.Port); binds != test.Binds {
+			t.Errorf("expected %v binding %v:%v to be %v, got %v", test.Listen, test.Address, test.Port, test.Binds, binds)
+		}
+	}
+}
+
+func TestLinkServerSockets(t *testing.T) {
+	https := NginxServer{Instance: "nginx", Listen: []string{"443"}}
+	http := NginxServer{Instance: "nginx", Listen: []string{"80"}}
+
+	item := sdp.Item{
+		LinkedItemRequests: serverLinks("test", []NginxServer{https, http}),
+	}
+
+	socket := &sdp.Reference{
+		Type:                 "socket",
+		UniqueAttributeValue: "0.0.0.0:443",
+		Context:              "test",
+	}
+
+	linkServerSockets(&item, "0.0.0.0", 443, socket)
+
+	for i, expected := range []int{1, 0} {
+		var server NginxServer
+
+		if err := json.Unmarshal([]byte(item.LinkedItemRequests[i].Query), &server); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(server.Sockets) != expected {
+			t.Errorf("expected %v to have %v sockets, got %v", server.Label(), expected, server.Sockets)
+		}
+	}
+}
+
+func TestListServers(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/etc/nginx/nginx.conf",
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "http",
+						Line:      1,
+						Block: []crossplane.Directive{
+							{
+								Directive: "upstream",
+								Line:      2,
+								Args:      []string{"app"},
+								Block: []crossplane.Directive{
+									{Directive: "server", Line: 3, Args: []string{"10.0.0.1"}},
+								},
+							},
+							{
+								Directive: "server",
+								Line:      5,
+								Block: []crossplane.Directive{
+									{Directive: "listen", Line: 6, Args: []string{"443", "ssl"}},
+									{Directive: "server_name", Line: 7, Args: []string{"example.com", "www.example.com"}},
+									{
+										Directive: "location",
+										Line:      8,
+										Args:      []string{"/api/"},
+										Block: []crossplane.Directive{
+											{Directive: "proxy_pass", Line: 9, Args: []string{"http://app"}},
+											{Directive: "set", Line: 10, Args: []string{"$namespace", "shop"}},
+											{Directive: "set", Line: 11, Args: []string{"$ingress_name", "web"}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	servers := listServers(resp, nil, "nginx", true, "")
+
+	if len(servers) != 1 {
+		t.Fatalf("expected 1 server, got %+v", servers)
+	}
+
+	server := servers[0]
+
+	if server.Label() != "example.com:443" || server.Name() != "example.com:443 /etc/nginx/nginx.conf:5@nginx" {
+		t.Errorf("unexpected server label %v and name %v", server.Label(), server.Name())
+	}
+
+	if server.File != "/etc/nginx/nginx.conf" || server.Line != 5 {
+		t.Errorf("unexpected server location %v:%v", server.File, server.Line)
+	}
+
+	if len(server.Locations) != 1 {
+		t.Fatalf("expected 1 location, got %+v", server.Locations)
+	}
+
+	location := server.Locations[0]
+
+	if location.Name() != "example.com:443 /etc/nginx/nginx.conf:5 /api/@nginx" || location.ProxyPass != "http://app" {
+		t.Errorf("unexpected location %+v", location)
+	}
+
+	if location.Ingress == nil || location.Ingress.Ingress != "web" || location.Ingress.Context != "shop" {
+		t.Errorf("unexpected ingress backend %+v", location.Ingress)
+	}
+}
+
+func TestListServersWithSameLabel(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/etc/nginx/nginx.conf",
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "http",
+						Line:      1,
+						Block: []crossplane.Directive{
+							{
+								Directive: "server",
+								Line:      2,
+								Block: []crossplane.Directive{
+									{Directive: "listen", Line: 3, Args: []string{"443", "ssl"}},
+									{Directive: "server_name", Line: 4, Args: []string{"example.com"}},
+									{Directive: "location", Line: 5, Args: []string{"/"}},
+								},
+							},
+							{
+								Directive: "server",
+								Line:      7,
+								Block: []crossplane.Directive{
+									{Directive: "listen", Line: 8, Args: []string{"[::]:443", "ssl"}},
+									{Directive: "server_name", Line: 9, Args: []string{"example.com"}},
+									{Directive: "location", Line: 10, Args: []string{"/"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	servers := listServers(resp, nil, "nginx", false, "")
+
+	if len(servers) != 2 {
+		t.Fatalf("expected 2 servers, got %+v", servers)
+	}
+
+	if servers[0].Label() != servers[1].Label() {
+		t.Errorf("expected both servers to have the same label, got %v and %v", servers[0].Label(), servers[1].Label())
+	}
+
+	if servers[0].Name() == servers[1].Name() {
+		t.Errorf("expected servers to have different names, got %v", servers[0].Name())
+	}
+
+	if servers[0].Locations[0].Name() == servers[1].Locations[0].Name() {
+		t.Errorf("expected locations to have different names, got %v", servers[0].Locations[0].Name())
+	}
+}
+
+func TestListServersWithoutHTTP(t *testing.T) {
+	resp := crossplane.Response{
+		Config: []crossplane.Config{
+			{
+				File: "/etc/nginx/conf.d/default.conf",
+				Parsed: []crossplane.Directive{
+					{
+						Directive: "server",
+						Line:      1,
+						Block: []crossplane.Directive{
+							{Directive: "listen", Line: 2, Args: []string{"80"}},
+						},
+					},
+					{
+						Directive: "stream",
+						Line:      5,
+						Block: []crossplane.Directive{
+							{
+								Directive: "server",
+								Line:      6,
+								Block: []crossplane.Directive{
+									{Directive: "listen", Line: 7, Args: []string{"5432"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	servers := listServers(resp, nil, "nginx", false, "")
+
+	if len(servers) != 1 || servers[0].Line != 1 {
+		t.Errorf("expected only the top level server, got %+v", servers)
+	}
+}
+
+func TestNginxServerSource(t *testing.T) {
+	server := NginxServer{
+		Instance:    "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+		ServerNames: []string{"example.com"},
+		Listen:      []string{"443"},
+		File:        "/etc/nginx/conf.d/default.conf",
+		Line:        1,
+		Locations: []NginxLocation{
+			{
+				Instance: "/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+				Server:   "example.com:443 /etc/nginx/conf.d/default.conf:1",
+				Path:     "/",
+			},
+		},
+	}
+
+	serverQuery, err := json.Marshal(server)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locationQuery, err := json.Marshal(server.Locations[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RunSourceTests(t, []SourceTest{
+		{
+			Name:        "with a server",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       string(serverQuery),
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"name":  "example.com:443 /etc/nginx/conf.d/default.conf:1@/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+						"label": "example.com:443",
+					},
+				},
+			},
+		},
+		{
+			Name:        "with an invalid query",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       "example.com",
+			ExpectedError: &ExpectedError{
+				Type:    sdp.ItemRequestError_OTHER,
+				Context: "test",
+			},
+		},
+	}, &NginxServerSource{})
+
+	RunSourceTests(t, []SourceTest{
+		{
+			Name:        "with a location",
+			ItemContext: "test",
+			Method:      sdp.RequestMethod_SEARCH,
+			Query:       string(locationQuery),
+			ExpectedItems: &ExpectedItems{
+				NumItems: 1,
+				ExpectedAttributes: []map[string]interface{}{
+					{
+						"name": "example.com:443 /etc/nginx/conf.d/default.conf:1 /@/usr/sbin/nginx -p /etc/nginx -c /etc/nginx/nginx.conf",
+						"path": "/",
+					},
+				},
+			},
+		},
+	}, &NginxLocationSource{})
+}
@@ -0,0 +1,263 @@
+package sources
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Products that can be identified from `nginx -V`
+const (
+	ProductNginx     = "nginx"
+	ProductNginxPlus = "nginx-plus"
+	ProductOpenResty = "openresty"
+	ProductTengine   = "tengine"
+	ProductAngie     = "angie"
+	ProductFreenginx = "freenginx"
+)
+
+type NginxVersionInfo struct {
+	// The version as printed by nginx e.g. `nginx/1.20.2` or
+	// `openresty/1.21.4.3`
+	Version string
+
+	// The distribution or fork of nginx, one of the Product constants
+	Product string
+
+	// The version of upstream nginx that the product is based on e.g.
+	// `1.21.4` for OpenResty 1.21.4.3. This is empty if it can't be
+	// determined
+	CoreVersion string
+
+	// The version of the fork itself e.g. `1.21.4.3` for OpenResty or
+	// `r31-p1` for NGINX Plus. Empty for plain nginx
+	ForkVersion string
+
+	// Versions of bundled third-party modules, taken from the names of the
+	// source directories in the configure arguments e.g. `ngx_lua-0.10.26`
+	Components map[string]string
+
+	// The full `built by` line, and the compiler and its version parsed
+	// from it e.g. `gcc` and `9.3.0`
+	BuiltBy         string
+	Compiler        string
+	CompilerVersion string
+
+	// The TLS library nginx was built with e.g. `OpenSSL`, `LibreSSL` or
+	// `BoringSSL`, and the version it was built against
+	SSLLibrary string
+	OpenSSL    string
+
+	// The version of the TLS library that nginx is running with, if it
+	// differs from the one it was built with. When this is set
+	// OpenSSLMismatch is true
+	RunningOpenSSL  string
+	OpenSSLMismatch bool
+
+	// Whether TLS SNI support is enabled
+	TLSSNI bool
+
+	ConfigArgs   []string
+	BuildProfile NginxBuildProfile
+
+	// Any lines of output that weren't recognised, so that nothing is lost
+	UnrecognisedLines []string
+}
+
+var versionRegex = regexp.MustCompile(`nginx version:\s+(\S+)`)
+var bannerRegex = regexp.MustCompile(`(?m)^(\S+) version:\s+(\S+?)/(\S+)(?:\s+\((.*)\))?`)
+var builtByRegex = regexp.MustCompile(`built by\s+(.*)`)
+var opensslRegex = regexp.MustCompile(`built with OpenSSL\s+(\S+)`)
+var builtWithRegex = regexp.MustCompile(`built with (\S+)`)
+var runningWithRegex = regexp.MustCompile(`\(running with ([^)\s]+)(?:\s+([^)\s]+))?`)
+var compilerRegex = regexp.MustCompile(`^(\S+)\s+(\d\S*)`)
+var configArgsRegex = regexp.MustCompile(`configure arguments: (.*)`)
+var eachArgRegex = regexp.MustCompile(`(-(\S+'.*?'|\S+)\s??)`)
+var componentRegex = regexp.MustCompile(`^(.+?)-v?(\d+(?:\.\d+)+\w*)$`)
+
+// parseVersionInfo Parses version information from `nginx -V`
+func parseVersionInfo(infoString string) NginxVersionInfo {
+	versionInfo := NginxVersionInfo{}
+
+	if matches := versionRegex.FindStringSubmatch(infoString); len(matches) == 2 {
+		versionInfo.Version = matches[1]
+	}
+
+	parseProduct(&versionInfo, infoString)
+
+	if matches := builtByRegex.FindStringSubmatch(infoString); len(matches) == 2 {
+		versionInfo.BuiltBy = matches[1]
+	}
+
+	if matches := compilerRegex.FindStringSubmatch(versionInfo.BuiltBy); len(matches) == 3 {
+		versionInfo.Compiler = matches[1]
+		versionInfo.CompilerVersion = matches[2]
+	}
+
+	if matches := opensslRegex.FindStringSubmatch(infoString); len(matches) == 2 {
+		versionInfo.OpenSSL = matches[1]
+	}
+
+	parseTLSInfo(&versionInfo, infoString)
+
+	if matches := configArgsRegex.FindStringSubmatch(infoString); len(matches) == 2 {
+		if argMatches := eachArgRegex.FindAllStringSubmatch(matches[1], -1); len(argMatches) > 0 {
+			for _, thisArg := range argMatches {
+				if len(thisArg) >= 2 {
+					versionInfo.ConfigArgs = append(versionInfo.ConfigArgs, thisArg[1])
+				}
+			}
+		}
+
+		versionInfo.BuildProfile = parseBuildProfile(versionInfo.ConfigArgs)
+		versionInfo.Components = parseComponents(versionInfo.BuildProfile)
+	}
+
+	for _, line := range strings.Split(infoString, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line != "" && !isKnownVersionLine(line) {
+			versionInfo.UnrecognisedLines = append(versionInfo.UnrecognisedLines, line)
+		}
+	}
+
+	return versionInfo
+}
+
+// parseTLSInfo Parses the TLS library details. If the library nginx is
+// running with differs from the one it was built with, nginx appends it to
+// the `built with` line e.g. `built with OpenSSL 1.1.1f  31 Mar 2020 (running
+// with OpenSSL 1.1.1k  25 Mar 2021)`
+func parseTLSInfo(versionInfo *NginxVersionInfo, infoString string) {
+	for _, line := range strings.Split(infoString, "\n") {
+		if strings.HasPrefix(line, "TLS SNI support") {
+			versionInfo.TLSSNI = strings.Contains(line, "enabled")
+			continue
+		}
+
+		matches := builtWithRegex.FindStringSubmatch(line)
+
+		if len(matches) != 2 {
+			continue
+		}
+
+		versionInfo.SSLLibrary = matches[1]
+
+		// BoringSSL reports itself as a compatible version of OpenSSL
+		if strings.Contains(line, "BoringSSL") {
+			versionInfo.SSLLibrary = "BoringSSL"
+		}
+
+		if versionInfo.OpenSSL == "" {
+			if fields := strings.Fields(strings.TrimPrefix(line, matches[0])); len(fields) > 0 && !strings.HasPrefix(fields[0], "(") {
+				versionInfo.OpenSSL = fields[0]
+			}
+		}
+
+		if running := runningWithRegex.FindStringSubmatch(line); len(running) == 3 {
+			versionInfo.RunningOpenSSL = strings.TrimSpace(running[1] + " " + running[2])
+
+			if running[2] != "" && running[1] == versionInfo.SSLLibrary {
+				versionInfo.RunningOpenSSL = running[2]
+			}
+
+			versionInfo.OpenSSLMismatch = versionInfo.RunningOpenSSL != versionInfo.OpenSSL
+		}
+	}
+}
+
+// isKnownVersionLine Returns whether a line of `nginx -V` output is one that
+// is parsed into a field
+func isKnownVersionLine(line string) bool {
+	for _, prefix := range []string{"built by ", "built with ", "TLS SNI support", "configure arguments:"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	return bannerRegex.MatchString(line)
+}
+
+// parseProduct Identifies the product and its versions from the banner lines
+// of `nginx -V`. Tengine and Angie print their own banner, and Tengine
+// follows it with the nginx version it is based on. OpenResty and freenginx
+// replace the name in the `nginx version` line, and NGINX Plus adds its
+// release in brackets e.g. `nginx/1.25.3 (nginx-plus-r31-p1)`
+func parseProduct(versionInfo *NginxVersionInfo, infoString string) {
+	for _, matches := range bannerRegex.FindAllStringSubmatch(infoString, -1) {
+		banner, name, version, extra := matches[1], matches[2], matches[3], matches[4]
+
+		switch strings.ToLower(banner) {
+		case "tengine":
+			versionInfo.Product = ProductTengine
+			versionInfo.ForkVersion = version
+		case "angie":
+			versionInfo.Product = ProductAngie
+			versionInfo.ForkVersion = version
+		case "nginx":
+			switch strings.ToLower(name) {
+			case "openresty":
+				// OpenResty appends its own release to the nginx version
+				// e.g. 1.21.4.3
+				versionInfo.Product = ProductOpenResty
+				versionInfo.ForkVersion = version
+				versionInfo.CoreVersion = strings.Join(firstN(strings.Split(version, "."), 3), ".")
+			case "freenginx":
+				// freenginx continues the nginx version numbering
+				versionInfo.Product = ProductFreenginx
+				versionInfo.ForkVersion = version
+				versionInfo.CoreVersion = version
+			default:
+				versionInfo.CoreVersion = version
+
+				if strings.HasPrefix(extra, "nginx-plus") {
+					versionInfo.Product = ProductNginxPlus
+					versionInfo.ForkVersion = strings.TrimPrefix(strings.TrimPrefix(extra, "nginx-plus"), "-")
+				}
+			}
+		}
+	}
+
+	if versionInfo.Version == "" && versionInfo.ForkVersion != "" {
+		// Forks that don't print an `nginx version` line are identified by
+		// their own banner instead
+		if matches := bannerRegex.FindStringSubmatch(infoString); len(matches) == 5 {
+			versionInfo.Version = matches[2] + "/" + matches[3]
+		}
+	}
+
+	if versionInfo.Product == "" && versionInfo.CoreVersion != "" {
+		versionInfo.Product = ProductNginx
+	}
+}
+
+// parseComponents Returns the versions of third-party modules whose source
+// directories end in a version number, as is the case for the modules that
+// are bundled with OpenResty
+func parseComponents(profile NginxBuildProfile) map[string]string {
+	var components map[string]string
+
+	for _, source := range append(append([]string{}, profile.AddModules...), profile.AddDynamicModules...) {
+		matches := componentRegex.FindStringSubmatch(path.Base(strings.TrimRight(source, "/")))
+
+		if len(matches) != 3 {
+			continue
+		}
+
+		if components == nil {
+			components = make(map[string]string)
+		}
+
+		components[matches[1]] = matches[2]
+	}
+
+	return components
+}
+
+func firstN(s []string, n int) []string {
+	if len(s) > n {
+		return s[:n]
+	}
+
+	return s
+}
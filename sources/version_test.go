@@ -0,0 +1,141 @@
+package sources
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+func TestParseVersionInfo(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+
+	tests := []struct {
+		File        string
+		Version     string
+		Product     string
+		CoreVersion string
+		ForkVersion string
+		Components  map[string]string
+	}{
+		{"nginx.txt", "nginx/1.20.2", ProductNginx, "1.20.2", "", nil},
+		{"openresty.txt", "openresty/1.21.4.3", ProductOpenResty, "1.21.4", "1.21.4.3", map[string]string{
+			"ngx_devel_kit":             "0.3.3",
+			"echo-nginx-module":         "0.63",
+			"headers-more-nginx-module": "0.35",
+			"ngx_lua":                   "0.10.26",
+			"stream-lua-nginx-module":   "0.0.14",
+		}},
+		{"tengine.txt", "nginx/1.24.0", ProductTengine, "1.24.0", "3.1.0", nil},
+		{"angie.txt", "Angie/1.4.1", ProductAngie, "", "1.4.1", nil},
+		{"freenginx.txt", "freenginx/1.27.2", ProductFreenginx, "1.27.2", "1.27.2", nil},
+		{"nginx-plus.txt", "nginx/1.25.3", ProductNginxPlus, "1.25.3", "r31-p1", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.File, func(t *testing.T) {
+			b, err := os.ReadFile(path.Join(path.Dir(filename), "test/version", test.File))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info := parseVersionInfo(string(b))
+
+			stringTests := map[string][2]string{
+				"Version":     {info.Version, test.Version},
+				"Product":     {info.Product, test.Product},
+				"CoreVersion": {info.CoreVersion, test.CoreVersion},
+				"ForkVersion": {info.ForkVersion, test.ForkVersion},
+			}
+
+			for field, values := range stringTests {
+				if values[0] != values[1] {
+					t.Errorf("expected %v to be %v, got %v", field, values[1], values[0])
+				}
+			}
+
+			if len(info.Components) != len(test.Components) {
+				t.Errorf("expected components %v, got %v", test.Components, info.Components)
+			}
+
+			for name, version := range test.Components {
+				if info.Components[name] != version {
+					t.Errorf("expected component %v to be %v, got %v", name, version, info.Components[name])
+				}
+			}
+
+			if info.OpenSSL == "" || info.BuiltBy == "" || len(info.ConfigArgs) == 0 {
+				t.Errorf("expected build details to be parsed, got %+v", info)
+			}
+		})
+	}
+}
+
+func TestParseBuildMetadata(t *testing.T) {
+	_, filename, _, _ := runtime.Caller(0)
+
+	t.Run("with a different running OpenSSL", func(t *testing.T) {
+		b, err := os.ReadFile(path.Join(path.Dir(filename), "test/version/openssl-mismatch.txt"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info := parseVersionInfo(string(b))
+
+		stringTests := map[string][2]string{
+			"Compiler":        {info.Compiler, "clang"},
+			"CompilerVersion": {info.CompilerVersion, "14.0.0"},
+			"SSLLibrary":      {info.SSLLibrary, "OpenSSL"},
+			"OpenSSL":         {info.OpenSSL, "1.1.1t-freebsd"},
+			"RunningOpenSSL":  {info.RunningOpenSSL, "3.0.13"},
+		}
+
+		for field, values := range stringTests {
+			if values[0] != values[1] {
+				t.Errorf("expected %v to be %v, got %v", field, values[1], values[0])
+			}
+		}
+
+		if !info.OpenSSLMismatch {
+			t.Error("expected OpenSSLMismatch to be true")
+		}
+
+		if !info.TLSSNI {
+			t.Error("expected TLSSNI to be true")
+		}
+
+		if len(info.UnrecognisedLines) != 1 || info.UnrecognisedLines[0] != "compiled with debug logging" {
+			t.Errorf("expected one unrecognised line, got %v", info.UnrecognisedLines)
+		}
+	})
+
+	t.Run("with the same OpenSSL", func(t *testing.T) {
+		info := parseVersionInfo("nginx version: nginx/1.20.2\nbuilt by gcc 9.3.0 (Ubuntu 9.3.0-10ubuntu2) \nbuilt with OpenSSL 1.1.1f  31 Mar 2020\nTLS SNI support disabled\n")
+
+		if info.OpenSSLMismatch || info.RunningOpenSSL != "" {
+			t.Errorf("expected no mismatch, got %v", info.RunningOpenSSL)
+		}
+
+		if info.TLSSNI {
+			t.Error("expected TLSSNI to be false")
+		}
+
+		if info.Compiler != "gcc" || info.CompilerVersion != "9.3.0" {
+			t.Errorf("unexpected compiler %v %v", info.Compiler, info.CompilerVersion)
+		}
+
+		if len(info.UnrecognisedLines) != 0 {
+			t.Errorf("expected no unrecognised lines, got %v", info.UnrecognisedLines)
+		}
+	})
+
+	t.Run("with LibreSSL", func(t *testing.T) {
+		info := parseVersionInfo("nginx version: nginx/1.24.0\nbuilt with LibreSSL 3.8.2\n")
+
+		if info.SSLLibrary != "LibreSSL" || info.OpenSSL != "3.8.2" {
+			t.Errorf("unexpected TLS library %v %v", info.SSLLibrary, info.OpenSSL)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package sources
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Advisory A security advisory from http://nginx.org/en/security_advisories.html
+type Advisory struct {
+	CVEs     []string `json:"cves"`
+	Title    string   `json:"title"`
+	Severity string   `json:"severity"`
+
+	// Ranges of affected versions e.g. `1.5.13-1.27.0`, or single versions
+	Vulnerable []string `json:"vulnerable"`
+
+	// Versions that contain the fix. A trailing `+` means that all later
+	// versions in the same stable or mainline branch are also fixed, with the
+	// highest of these covering all later versions
+	NotVulnerable []string `json:"not_vulnerable"`
+
+	// The configure argument that builds the affected module e.g.
+	// `--with-http_mp4_module`. If this is empty the affected code is always
+	// built in
+	ConfigureArg string `json:"configure_arg,omitempty"`
+}
+
+// Vulnerability A CVE that affects an nginx instance
+type Vulnerability struct {
+	CVE      string
+	Severity string
+	Title    string
+}
+
+//go:embed advisories.json
+var bundledAdvisoriesJSON []byte
+
+// BundledAdvisories The advisories that are built into the source, used
+// unless a file is provided
+var BundledAdvisories = mustParseAdvisories(bundledAdvisoriesJSON)
+
+func mustParseAdvisories(b []byte) []Advisory {
+	var advisories []Advisory
+
+	if err := json.Unmarshal(b, &advisories); err != nil {
+		panic(fmt.Sprintf("invalid bundled advisories: %v", err))
+	}
+
+	return advisories
+}
+
+// LoadAdvisories Loads advisories from a JSON file in the same format as the
+// bundled dataset, allowing it to be updated without a new release
+func LoadAdvisories(path string) ([]Advisory, error) {
+	var advisories []Advisory
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &advisories); err != nil {
+		return nil, err
+	}
+
+	return advisories, nil
+}
+
+// advisoryProducts Products whose code is that of the nginx release given by
+// their core version, so the nginx.org advisories apply to them. NGINX Plus
+// and forks such as freenginx and Angie fix vulnerabilities in their own
+// patch releases (e.g. R31 P1) so their versions can't be checked against
+// nginx's ranges
+var advisoryProducts = map[string]bool{
+	ProductNginx:     true,
+	ProductOpenResty: true,
+	ProductTengine:   true,
+}
+
+// coveredByAdvisories Returns whether the nginx.org advisories apply to a
+// product. The core version has to be known to check it
+func coveredByAdvisories(versionInfo NginxVersionInfo) bool {
+	return advisoryProducts[versionInfo.Product] && versionInfo.CoreVersion != ""
+}
+
+// findVulnerabilities Returns the vulnerabilities from the advisories that
+// affect the given version, taking into account which modules were built
+func findVulnerabilities(advisories []Advisory, version string, configArgs []string) []Vulnerability {
+	var vulnerabilities []Vulnerability
+
+	v, err := parseVersionNumber(version)
+
+	if err != nil {
+		return nil
+	}
+
+	for _, advisory := range advisories {
+		if advisory.ConfigureArg != "" && !hasConfigArg(configArgs, advisory.ConfigureArg) {
+			continue
+		}
+
+		if !advisory.affects(v) {
+			continue
+		}
+
+		for _, cve := range advisory.CVEs {
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				CVE:      cve,
+				Severity: advisory.Severity,
+				Title:    advisory.Title,
+			})
+		}
+	}
+
+	return vulnerabilities
+}
+
+// affects Returns whether the version is affected by the advisory
+func (a Advisory) affects(v versionNumber) bool {
+	var vulnerable bool
+
+	for _, r := range a.Vulnerable {
+		from, to, _ := strings.Cut(r, "-")
+
+		if to == "" {
+			to = from
+		}
+
+		fromVersion, err := parseVersionNumber(from)
+
+		if err != nil {
+			continue
+		}
+
+		toVersion, err := parseVersionNumber(to)
+
+		if err != nil {
+			continue
+		}
+
+		if v.compare(fromVersion) >= 0 && v.compare(toVersion) <= 0 {
+			vulnerable = true
+		}
+	}
+
+	if !vulnerable {
+		return false
+	}
+
+	var highest versionNumber
+
+	for _, fixed := range a.NotVulnerable {
+		fixedVersion, err := parseVersionNumber(strings.TrimSuffix(fixed, "+"))
+
+		if err != nil {
+			continue
+		}
+
+		if !strings.HasSuffix(fixed, "+") {
+			if v.compare(fixedVersion) == 0 {
+				return false
+			}
+
+			continue
+		}
+
+		if v.sameBranch(fixedVersion) && v.compare(fixedVersion) >= 0 {
+			return false
+		}
+
+		if highest == nil || fixedVersion.compare(highest) > 0 {
+			highest = fixedVersion
+		}
+	}
+
+	if highest != nil && v.compare(highest) >= 0 {
+		return false
+	}
+
+	return true
+}
+
+// versionNumber The numeric parts of a version e.g. 1.20.2
+type versionNumber []int
+
+// parseVersionNumber Parses a version number. Anything before a `/` is
+// ignored so that the output of `nginx -V` such as `nginx/1.20.2` can be
+// passed directly
+func parseVersionNumber(s string) (versionNumber, error) {
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[i+1:]
+	}
+
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	v := make(versionNumber, len(parts))
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+
+		v[i] = n
+	}
+
+	return v, nil
+}
+
+// compare Returns -1, 0 or 1 if the version is lower, equal or higher than the
+// other. Missing parts are treated as zero
+func (v versionNumber) compare(other versionNumber) int {
+	for i := 0; i < len(v) || i < len(other); i++ {
+		var a, b int
+
+		if i < len(v) {
+			a = v[i]
+		}
+
+		if i < len(other) {
+			b = other[i]
+		}
+
+		if a < b {
+			return -1
+		}
+
+		if a > b {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// sameBranch Returns whether both versions have the same major and minor
+// version e.g. 1.26.1 and 1.26.3
+func (v versionNumber) sameBranch(other versionNumber) bool {
+	return len(v) >= 2 && len(other) >= 2 && v[0] == other[0] && v[1] == other[1]
+}
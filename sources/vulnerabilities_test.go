@@ -0,0 +1,123 @@
+package sources
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestAdvisoryAffects(t *testing.T) {
+	advisory := Advisory{
+		Vulnerable:    []string{"1.5.13-1.27.0", "1.0.7-1.0.15"},
+		NotVulnerable: []string{"1.27.1+", "1.26.2+"},
+	}
+
+	tests := map[string]bool{
+		"1.5.12": false,
+		"1.5.13": true,
+		"1.20.2": true,
+		"1.26.1": true,
+		"1.26.2": false,
+		"1.26.3": false,
+		"1.27.0": true,
+		"1.27.1": false,
+		"1.29.0": false,
+		"1.0.10": true,
+		"1.1.0":  false,
+	}
+
+	for version, expected := range tests {
+		v, err := parseVersionNumber(version)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if affected := advisory.affects(v); affected != expected {
+			t.Errorf("expected %v affected to be %v, got %v", version, expected, affected)
+		}
+	}
+}
+
+func TestFindVulnerabilities(t *testing.T) {
+	t.Run("with the bundled advisories", func(t *testing.T) {
+		if len(BundledAdvisories) == 0 {
+			t.Fatal("no bundled advisories")
+		}
+
+		withMP4 := findVulnerabilities(BundledAdvisories, "nginx/1.20.2", []string{"--with-http_mp4_module"})
+		withoutMP4 := findVulnerabilities(BundledAdvisories, "nginx/1.20.2", []string{})
+
+		if !containsCVE(withMP4, "CVE-2024-7347") {
+			t.Errorf("expected CVE-2024-7347 to be found with the mp4 module, got %v", withMP4)
+		}
+
+		if containsCVE(withoutMP4, "CVE-2024-7347") {
+			t.Errorf("expected CVE-2024-7347 not to be found without the mp4 module, got %v", withoutMP4)
+		}
+
+		if containsCVE(withoutMP4, "CVE-2021-23017") {
+			t.Errorf("expected CVE-2021-23017 not to be found since it was fixed in 1.20.1, got %v", withoutMP4)
+		}
+	})
+
+	t.Run("with an invalid version", func(t *testing.T) {
+		if v := findVulnerabilities(BundledAdvisories, "nginx/unknown", nil); len(v) != 0 {
+			t.Errorf("expected no vulnerabilities, got %v", v)
+		}
+	})
+
+	t.Run("with advisories from a file", func(t *testing.T) {
+		file := path.Join(t.TempDir(), "advisories.json")
+		content := `[{"cves": ["CVE-0000-0001"], "title": "Test", "severity": "low", "vulnerable": ["1.20.2"]}]`
+
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		advisories, err := LoadAdvisories(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := findVulnerabilities(advisories, "nginx/1.20.2", nil)
+
+		if len(v) != 1 || v[0].CVE != "CVE-0000-0001" || v[0].Severity != "low" {
+			t.Errorf("unexpected vulnerabilities %v", v)
+		}
+	})
+}
+
+func TestCoveredByAdvisories(t *testing.T) {
+	tests := []struct {
+		Banner   string
+		Expected bool
+	}{
+		{"nginx version: nginx/1.20.2", true},
+		{"nginx version: openresty/1.21.4.3", true},
+		{"Tengine version: Tengine/2.3.3\nnginx version: nginx/1.18.0", true},
+		{"nginx version: nginx/1.25.3 (nginx-plus-r31-p1)", false},
+		{"nginx version: freenginx/1.25.4", false},
+		{"Angie version: Angie/1.4.0", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		versionInfo := parseVersionInfo(test.Banner)
+
+		if covered := coveredByAdvisories(versionInfo); covered != test.Expected {
+			t.Errorf("expected %q (%v) covered to be %v, got %v", test.Banner, versionInfo.Product, test.Expected, covered)
+		}
+	}
+}
+
+func containsCVE(vulnerabilities []Vulnerability, cve string) bool {
+	for _, v := range vulnerabilities {
+		if v.CVE == cve {
+			return true
+		}
+	}
+
+	return false
+}
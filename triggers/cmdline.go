@@ -0,0 +1,61 @@
+package triggers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// masterProcessPrefix nginx changes the command line of its master process
+// to this followed by the original command line e.g. `nginx: master process
+// /usr/sbin/nginx -c /etc/nginx/nginx.conf`
+const masterProcessPrefix = "nginx: master process "
+
+// IsMasterProcess Returns whether a process's command line, as shown by `ps
+// -o args=`, is an nginx master process
+func IsMasterProcess(cmdline string) bool {
+	return strings.HasPrefix(strings.TrimSpace(cmdline), masterProcessPrefix)
+}
+
+// ParseMasterProcess Parses the command line of an nginx master process into
+// the binary and arguments it was started with. Since the command line has
+// already been split and re-joined with spaces, the value of `-g` is taken to
+// be every word up to and including the one that ends in `;`
+func ParseMasterProcess(cmdline string) (*ServiceData, error) {
+	cmdline = strings.TrimSpace(cmdline)
+
+	if !IsMasterProcess(cmdline) {
+		return nil, fmt.Errorf("%q is not an nginx master process", cmdline)
+	}
+
+	words := strings.Fields(strings.TrimPrefix(cmdline, masterProcessPrefix))
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%q does not contain the nginx binary", cmdline)
+	}
+
+	data := ServiceData{
+		Binary: words[0],
+		Args:   make([]string, 0),
+	}
+
+	for i := 1; i < len(words); i++ {
+		if words[i] != "-g" {
+			data.Args = append(data.Args, words[i])
+			continue
+		}
+
+		var globals []string
+
+		for i++; i < len(words); i++ {
+			globals = append(globals, words[i])
+
+			if strings.HasSuffix(words[i], ";") && (i+1 == len(words) || strings.HasPrefix(words[i+1], "-")) {
+				break
+			}
+		}
+
+		data.Args = append(data.Args, "-g", strings.Join(globals, " "))
+	}
+
+	return &data, nil
+}
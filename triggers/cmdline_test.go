@@ -0,0 +1,51 @@
+package triggers
+
+import (
+	"testing"
+)
+
+func TestParseMasterProcess(t *testing.T) {
+	tests := []struct {
+		Cmdline string
+		Binary  string
+		Args    []string
+	}{
+		{"nginx: master process /usr/sbin/nginx", "/usr/sbin/nginx", []string{}},
+		{"nginx: master process nginx -c /opt/app/nginx.conf", "nginx", []string{"-c", "/opt/app/nginx.conf"}},
+		{
+			"nginx: master process /usr/sbin/nginx -g daemon on; master_process on; -p /srv/nginx",
+			"/usr/sbin/nginx",
+			[]string{"-g", "daemon on; master_process on;", "-p", "/srv/nginx"},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := ParseMasterProcess(test.Cmdline)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data.Binary != test.Binary {
+			t.Errorf("expected binary %v, got %v", test.Binary, data.Binary)
+		}
+
+		if len(data.Args) != len(test.Args) {
+			t.Errorf("expected args %v, got %v", test.Args, data.Args)
+			continue
+		}
+
+		for i := range test.Args {
+			if data.Args[i] != test.Args[i] {
+				t.Errorf("expected args %v, got %v", test.Args, data.Args)
+				break
+			}
+		}
+	}
+
+	for _, invalid := range []string{"nginx: worker process", "/usr/sbin/nginx -c /etc/nginx/nginx.conf", "nginx: master process "} {
+		if _, err := ParseMasterProcess(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
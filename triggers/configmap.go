@@ -0,0 +1,80 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/sdp-go"
+)
+
+// Data required if the TriggerType is "configmap". The config is passed in
+// the query itself since it is parsed without running any commands
+type ConfigMapData struct {
+	Name string `json:"name,omitempty"`
+
+	// The contents of each config file, keyed by the ConfigMap key
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// This trigger is based on Kubernetes ConfigMap items that contain nginx
+// config, so that config can be seen before it is deployed. Only keys named
+// `nginx.conf` or ending in `.conf` are included
+var ConfigMapTrigger = discovery.Trigger{
+	Type: "configmap",
+	RequestGenerator: func(in *sdp.Item) (*sdp.ItemRequest, error) {
+		dataInterface, err := in.Attributes.Get("data")
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, ok := dataInterface.(map[string]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf("unexpected data %v", dataInterface)
+		}
+
+		files := make(map[string]string)
+
+		for key, value := range data {
+			if IsConfigFileName(key) {
+				files[key] = fmt.Sprint(value)
+			}
+		}
+
+		if len(files) == 0 {
+			return nil, fmt.Errorf("configmap %v contains no nginx config", in.UniqueAttributeValue())
+		}
+
+		ref := in.Reference()
+
+		td := TriggerData{
+			TriggerType:    CONFIGMAP,
+			TriggerItemRef: &ref,
+			ConfigMapData: &ConfigMapData{
+				Name:  in.UniqueAttributeValue(),
+				Files: files,
+			},
+		}
+
+		b, err := json.Marshal(td)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &sdp.ItemRequest{
+			Type:   "nginx-config",
+			Method: sdp.RequestMethod_SEARCH,
+			Query:  string(b),
+		}, nil
+	},
+}
+
+// IsConfigFileName Returns whether a file name looks like nginx config i.e.
+// `nginx.conf` or anything ending in `.conf`
+func IsConfigFileName(name string) bool {
+	return path.Ext(name) == ".conf"
+}
@@ -0,0 +1,78 @@
+package triggers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestConfigMapTrigger(t *testing.T) {
+	t.Run("with nginx config", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"name": "nginx",
+			"data": map[string]interface{}{
+				"nginx.conf":   "events {}\nhttp {\n    include conf.d/*.conf;\n}\n",
+				"default.conf": "server {\n    listen 80;\n}\n",
+				"index.html":   "<h1>hello</h1>",
+			},
+		})
+
+		item := sdp.Item{
+			Type:            "configmap",
+			UniqueAttribute: "name",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		req, err := ConfigMapTrigger.ProcessItem(&item)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := "nginx-config"; req.Type != expected {
+			t.Errorf("expected req.Type to be %v, got %v", expected, req.Type)
+		}
+
+		var td TriggerData
+
+		err = json.Unmarshal([]byte(req.Query), &td)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := CONFIGMAP; td.TriggerType != expected {
+			t.Errorf("expected td.TriggerType to be %v, got %v", expected, td.TriggerType)
+		}
+
+		if td.ConfigMapData == nil || td.ConfigMapData.Name != "nginx" {
+			t.Fatalf("unexpected td.ConfigMapData %+v", td.ConfigMapData)
+		}
+
+		if len(td.ConfigMapData.Files) != 2 {
+			t.Errorf("expected only the config files, got %v", td.ConfigMapData.Files)
+		}
+	})
+
+	t.Run("without nginx config", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"name": "app-settings",
+			"data": map[string]interface{}{
+				"settings.json": "{}",
+			},
+		})
+
+		item := sdp.Item{
+			Type:            "configmap",
+			UniqueAttribute: "name",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		if _, err := ConfigMapTrigger.ProcessItem(&item); err == nil {
+			t.Error("expected the trigger not to fire")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/sdp-go"
+)
+
+// Data required if the TriggerType is "container"
+type ContainerData struct {
+	ID    string `json:"id,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// nginxImageNames The final component of the names of images that run
+// nginx. Other images in the same repositories, such as exporters and
+// gateways, don't run nginx itself
+var nginxImageNames = map[string]bool{
+	"nginx":              true,
+	"nginx-unprivileged": true,
+	"openresty":          true,
+}
+
+// isNginxImage Returns whether an image runs nginx, based on the final
+// component of its name e.g. `nginx:1.25`, `openresty/openresty:alpine` or
+// `registry.k8s.io/ingress-nginx/controller:v1.9.4`. The tag and digest are
+// ignored
+func isNginxImage(image string) bool {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+
+	// A colon before the last slash is the port of the registry
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	components := strings.Split(image, "/")
+	name := components[len(components)-1]
+
+	if name == "controller" && len(components) > 1 {
+		return components[len(components)-2] == "ingress-nginx"
+	}
+
+	return nginxImageNames[name]
+}
+
+// This trigger is based on container items, for nginx running in Docker.
+// Containers are identified by their ID, so the trigger fires on all of them
+// and only generates a request for those running an nginx image
+var ContainerTrigger = discovery.Trigger{
+	Type: "container",
+	RequestGenerator: func(in *sdp.Item) (*sdp.ItemRequest, error) {
+		image, err := containerImage(in)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !isNginxImage(image) {
+			return nil, fmt.Errorf("image %v is not an nginx image", image)
+		}
+
+		ref := in.Reference()
+
+		td := TriggerData{
+			TriggerType:    CONTAINER,
+			TriggerItemRef: &ref,
+			ContainerData: &ContainerData{
+				ID:    in.UniqueAttributeValue(),
+				Image: image,
+			},
+		}
+
+		b, err := json.Marshal(td)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &sdp.ItemRequest{
+			Type:   "nginx",
+			Method: sdp.RequestMethod_SEARCH,
+			Query:  string(b),
+		}, nil
+	},
+}
+
+// containerImage Returns the image of a container item, which is either a
+// top level attribute or part of the container's config
+func containerImage(in *sdp.Item) (string, error) {
+	for _, name := range []string{"image", "Image", "Config.Image"} {
+		if image, err := in.Attributes.Get(name); err == nil {
+			return fmt.Sprint(image), nil
+		}
+	}
+
+	return "", fmt.Errorf("container %v has no image", in.UniqueAttributeValue())
+}
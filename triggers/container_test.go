@@ -0,0 +1,74 @@
+package triggers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestContainerTrigger(t *testing.T) {
+	images := map[string]bool{
+		"nginx":                                       true,
+		"nginx:1.25-alpine":                           true,
+		"docker.io/library/nginx@sha256:abc":          true,
+		"nginxinc/nginx-unprivileged:stable":          true,
+		"openresty/openresty:alpine":                  true,
+		"registry.k8s.io/ingress-nginx/controller:v1": true,
+		"localhost:5000/nginx:1.25":                   true,
+		"redis:7":                                     false,
+		"mynginx:latest":                              false,
+		"nginx/nginx-prometheus-exporter:1.1":         false,
+		"nginx-exporter":                              false,
+		"nginxinc/nginx-s3-gateway:latest":            false,
+		"nginx/unit:1.31":                             false,
+		"nginx-unit":                                  false,
+		"registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1": false,
+		"example.com/controller:v1":                             false,
+	}
+
+	for image, matches := range images {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"id":    "4f66ad9a0b2e",
+			"image": image,
+		})
+
+		item := sdp.Item{
+			Type:            "container",
+			UniqueAttribute: "id",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		req, err := ContainerTrigger.ProcessItem(&item)
+
+		if !matches {
+			if err == nil {
+				t.Errorf("expected the trigger not to fire for %v", image)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: %v", image, err)
+			continue
+		}
+
+		var td TriggerData
+
+		err = json.Unmarshal([]byte(req.Query), &td)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := CONTAINER; td.TriggerType != expected {
+			t.Errorf("expected td.TriggerType to be %v, got %v", expected, td.TriggerType)
+		}
+
+		if td.ContainerData == nil || td.ContainerData.ID != "4f66ad9a0b2e" || td.ContainerData.Image != image {
+			t.Errorf("unexpected td.ContainerData %+v", td.ContainerData)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/sdp-go"
+)
+
+// Data required if the TriggerType is "file"
+type FileData struct {
+	Path string `json:"path,omitempty"`
+}
+
+// nginxConfigPathRegex Matches files within `/etc/nginx`, any `nginx.conf`
+// and anything in a `sites-enabled` directory
+var nginxConfigPathRegex = regexp.MustCompile(`^/etc/nginx/|/nginx\.conf$|/sites-enabled/[^/]+$`)
+
+// nonConfigExtensions Files within `/etc/nginx` that are certificates or keys
+// rather than config
+var nonConfigExtensions = map[string]bool{
+	".crt": true,
+	".csr": true,
+	".der": true,
+	".key": true,
+	".p12": true,
+	".pem": true,
+}
+
+// This trigger is based on file items for nginx config, which gives
+// visibility of config on hosts where nginx isn't running. The file is parsed
+// along with the files that it includes
+var FileTrigger = discovery.Trigger{
+	Type:                      "file",
+	UniqueAttributeValueRegex: nginxConfigPathRegex,
+	RequestGenerator: func(in *sdp.Item) (*sdp.ItemRequest, error) {
+		filePath := in.UniqueAttributeValue()
+
+		if nonConfigExtensions[path.Ext(filePath)] {
+			return nil, fmt.Errorf("%v is not an nginx config file", filePath)
+		}
+
+		ref := in.Reference()
+
+		td := TriggerData{
+			TriggerType:    FILE,
+			TriggerItemRef: &ref,
+			FileData: &FileData{
+				Path: filePath,
+			},
+		}
+
+		b, err := json.Marshal(td)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &sdp.ItemRequest{
+			Type:   "nginx-config",
+			Method: sdp.RequestMethod_SEARCH,
+			Query:  string(b),
+		}, nil
+	},
+}
@@ -0,0 +1,65 @@
+package triggers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestFileTrigger(t *testing.T) {
+	paths := map[string]bool{
+		"/etc/nginx/nginx.conf":                true,
+		"/etc/nginx/conf.d/default.conf":       true,
+		"/opt/app/nginx.conf":                  true,
+		"/usr/local/etc/sites-enabled/default": true,
+		"/etc/nginx/ssl/example.com.key":       false,
+		"/etc/nginx":                           false,
+		"/etc/nginx.conf.bak":                  false,
+		"/home/user/sites-enabled/a/b":         false,
+	}
+
+	for filePath, matches := range paths {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"path": filePath,
+		})
+
+		item := sdp.Item{
+			Type:            "file",
+			UniqueAttribute: "path",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		req, err := FileTrigger.ProcessItem(&item)
+
+		if !matches {
+			if err == nil {
+				t.Errorf("expected the trigger not to fire for %v", filePath)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: %v", filePath, err)
+			continue
+		}
+
+		if expected := "nginx-config"; req.Type != expected {
+			t.Errorf("expected req.Type to be %v, got %v", expected, req.Type)
+		}
+
+		var td TriggerData
+
+		err = json.Unmarshal([]byte(req.Query), &td)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if td.TriggerType != FILE || td.FileData == nil || td.FileData.Path != filePath {
+			t.Errorf("unexpected trigger data %+v", td)
+		}
+	}
+}
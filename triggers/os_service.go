@@ -13,6 +13,12 @@ type TriggerType int
 
 const (
 	SERVICE TriggerType = iota
+	PROCESS
+	CONTAINER
+	CONFIGMAP
+	PACKAGE
+	FILE
+	SOCKET
 )
 
 // Data that will be sent to the Search() method
@@ -20,6 +26,12 @@ type TriggerData struct {
 	TriggerType    TriggerType    `json:"trigger_type,omitempty"`
 	TriggerItemRef *sdp.Reference `json:"trigger_item_ref,omitempty"`
 	ServiceData    *ServiceData   `json:"service_data,omitempty"`
+	ProcessData    *ProcessData   `json:"process_data,omitempty"`
+	ContainerData  *ContainerData `json:"container_data,omitempty"`
+	ConfigMapData  *ConfigMapData `json:"configmap_data,omitempty"`
+	PackageData    *PackageData   `json:"package_data,omitempty"`
+	FileData       *FileData      `json:"file_data,omitempty"`
+	SocketData     *SocketData    `json:"socket_data,omitempty"`
 }
 
 // Data required if the TriggerType is "service"
@@ -30,6 +42,12 @@ type ServiceData struct {
 
 var AllTriggers = []discovery.Trigger{
 	ServiceTrigger,
+	ProcessTrigger,
+	ContainerTrigger,
+	ConfigMapTrigger,
+	PackageTrigger,
+	FileTrigger,
+	SocketTrigger,
 }
 
 // TODO: At this point I need to modify the trrigger so that is passes the
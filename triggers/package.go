@@ -0,0 +1,95 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/sdp-go"
+)
+
+// Data required if the TriggerType is "package"
+type PackageData struct {
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Maintainer string `json:"maintainer,omitempty"`
+
+	// Where the package installs the binary and its config by default
+	Binary   string `json:"binary,omitempty"`
+	ConfFile string `json:"conf_file,omitempty"`
+}
+
+// packageInstall Where a package installs nginx
+type packageInstall struct {
+	Binary   string
+	ConfFile string
+}
+
+// packageInstalls The default binary and config file of each package. The
+// Debian and Ubuntu variants all install the same binary with a different set
+// of modules
+var packageInstalls = map[string]packageInstall{
+	"nginx":        {"/usr/sbin/nginx", "/etc/nginx/nginx.conf"},
+	"nginx-core":   {"/usr/sbin/nginx", "/etc/nginx/nginx.conf"},
+	"nginx-full":   {"/usr/sbin/nginx", "/etc/nginx/nginx.conf"},
+	"nginx-light":  {"/usr/sbin/nginx", "/etc/nginx/nginx.conf"},
+	"nginx-extras": {"/usr/sbin/nginx", "/etc/nginx/nginx.conf"},
+	"nginx-plus":   {"/usr/sbin/nginx", "/etc/nginx/nginx.conf"},
+	"openresty":    {"/usr/local/openresty/nginx/sbin/nginx", "/usr/local/openresty/nginx/conf/nginx.conf"},
+}
+
+// This trigger is based on installed packages from dpkg, rpm or apk. It
+// searches for the instance using the package's default binary and config
+// file, and records the package so that vendor patch levels can be compared
+// with the build that is installed
+var PackageTrigger = discovery.Trigger{
+	Type:                      "package",
+	UniqueAttributeValueRegex: regexp.MustCompile(`^(nginx(-core|-full|-light|-extras|-plus)?|openresty)$`),
+	RequestGenerator: func(in *sdp.Item) (*sdp.ItemRequest, error) {
+		name := in.UniqueAttributeValue()
+		install, ok := packageInstalls[name]
+
+		if !ok {
+			return nil, fmt.Errorf("package %v is not a known nginx package", name)
+		}
+
+		ref := in.Reference()
+
+		td := TriggerData{
+			TriggerType:    PACKAGE,
+			TriggerItemRef: &ref,
+			PackageData: &PackageData{
+				Name:       name,
+				Version:    firstAttribute(in, "version", "Version"),
+				Maintainer: firstAttribute(in, "maintainer", "Maintainer", "vendor", "Vendor", "packager"),
+				Binary:     install.Binary,
+				ConfFile:   install.ConfFile,
+			},
+		}
+
+		b, err := json.Marshal(td)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &sdp.ItemRequest{
+			Type:   "nginx",
+			Method: sdp.RequestMethod_SEARCH,
+			Query:  string(b),
+		}, nil
+	},
+}
+
+// firstAttribute Returns the value of the first attribute that the item has,
+// since the attribute names differ between package managers
+func firstAttribute(in *sdp.Item, names ...string) string {
+	for _, name := range names {
+		if value, err := in.Attributes.Get(name); err == nil {
+			return fmt.Sprint(value)
+		}
+	}
+
+	return ""
+}
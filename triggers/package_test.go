@@ -0,0 +1,72 @@
+package triggers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestPackageTrigger(t *testing.T) {
+	t.Run("with an nginx package", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"name":       "openresty",
+			"version":    "1.21.4.1-1~focal1",
+			"maintainer": "OpenResty Admin <admin@openresty.com>",
+		})
+
+		item := sdp.Item{
+			Type:            "package",
+			UniqueAttribute: "name",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		req, err := PackageTrigger.ProcessItem(&item)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var td TriggerData
+
+		err = json.Unmarshal([]byte(req.Query), &td)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := PACKAGE; td.TriggerType != expected {
+			t.Errorf("expected td.TriggerType to be %v, got %v", expected, td.TriggerType)
+		}
+
+		expected := PackageData{
+			Name:       "openresty",
+			Version:    "1.21.4.1-1~focal1",
+			Maintainer: "OpenResty Admin <admin@openresty.com>",
+			Binary:     "/usr/local/openresty/nginx/sbin/nginx",
+			ConfFile:   "/usr/local/openresty/nginx/conf/nginx.conf",
+		}
+
+		if td.PackageData == nil || *td.PackageData != expected {
+			t.Errorf("expected td.PackageData to be %+v, got %+v", expected, td.PackageData)
+		}
+	})
+
+	t.Run("with another package", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"name": "nginx-common",
+		})
+
+		item := sdp.Item{
+			Type:            "package",
+			UniqueAttribute: "name",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		if _, err := PackageTrigger.ProcessItem(&item); err == nil {
+			t.Error("expected the trigger not to fire")
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/sdp-go"
+)
+
+// Data required if the TriggerType is "process"
+type ProcessData struct {
+	PID    int      `json:"pid,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Binary string   `json:"binary,omitempty"`
+}
+
+// This trigger is based on process items, for hosts where nginx isn't run by
+// systemd e.g. containers, supervisord or when started by hand. Process items
+// are identified by their pid, so the trigger fires on all of them and only
+// generates a request for nginx master processes
+var ProcessTrigger = discovery.Trigger{
+	Type: "process",
+	RequestGenerator: func(in *sdp.Item) (*sdp.ItemRequest, error) {
+		cmdline, err := processCmdline(in)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ParseMasterProcess(cmdline)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The master's command line contains the binary as it was started,
+		// which may not be a full path. Prefer the executable that the
+		// process is actually running if it is known
+		if !path.IsAbs(data.Binary) {
+			if exe, err := in.Attributes.Get("exe"); err == nil && fmt.Sprint(exe) != "" {
+				data.Binary = fmt.Sprint(exe)
+			}
+		}
+
+		pid, err := strconv.Atoi(in.UniqueAttributeValue())
+
+		if err != nil {
+			if pidInterface, err := in.Attributes.Get("pid"); err == nil {
+				pid, _ = strconv.Atoi(fmt.Sprint(pidInterface))
+			}
+		}
+
+		ref := in.Reference()
+
+		td := TriggerData{
+			TriggerType:    PROCESS,
+			TriggerItemRef: &ref,
+			ProcessData: &ProcessData{
+				PID:    pid,
+				Args:   data.Args,
+				Binary: data.Binary,
+			},
+		}
+
+		b, err := json.Marshal(td)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &sdp.ItemRequest{
+			Type:   "nginx",
+			Method: sdp.RequestMethod_SEARCH,
+			Query:  string(b),
+		}, nil
+	},
+}
+
+// processCmdline Returns the command line of a process item, which can be
+// either a string or a list of arguments
+func processCmdline(in *sdp.Item) (string, error) {
+	cmdline, err := in.Attributes.Get("cmdline")
+
+	if err != nil {
+		return "", err
+	}
+
+	switch c := cmdline.(type) {
+	case string:
+		return c, nil
+	case []interface{}:
+		args := make([]string, len(c))
+
+		for i, arg := range c {
+			args[i] = fmt.Sprint(arg)
+		}
+
+		return strings.Join(args, " "), nil
+	default:
+		return "", fmt.Errorf("unexpected cmdline %v", cmdline)
+	}
+}
@@ -0,0 +1,81 @@
+package triggers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestProcessTrigger(t *testing.T) {
+	t.Run("with an nginx master process", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"pid":     1234,
+			"cmdline": "nginx: master process nginx -c /opt/app/nginx.conf -g daemon off;",
+			"exe":     "/usr/sbin/nginx",
+		})
+
+		item := sdp.Item{
+			Type:            "process",
+			UniqueAttribute: "pid",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		req, err := ProcessTrigger.ProcessItem(&item)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var td TriggerData
+
+		err = json.Unmarshal([]byte(req.Query), &td)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := PROCESS; td.TriggerType != expected {
+			t.Errorf("expected td.TriggerType to be %v, got %v", expected, td.TriggerType)
+		}
+
+		if td.ProcessData == nil {
+			t.Fatal("td.ProcessData is nil")
+		}
+
+		if expected := 1234; td.ProcessData.PID != expected {
+			t.Errorf("expected td.ProcessData.PID to be %v, got %v", expected, td.ProcessData.PID)
+		}
+
+		if expected := "/usr/sbin/nginx"; td.ProcessData.Binary != expected {
+			t.Errorf("expected td.ProcessData.Binary to be %v, got %v", expected, td.ProcessData.Binary)
+		}
+
+		if len(td.ProcessData.Args) != 4 || td.ProcessData.Args[3] != "daemon off;" {
+			t.Errorf("unexpected td.ProcessData.Args %v", td.ProcessData.Args)
+		}
+
+		if td.TriggerItemRef == nil || td.TriggerItemRef.Type != "process" {
+			t.Errorf("expected a reference to the process, got %v", td.TriggerItemRef)
+		}
+	})
+
+	t.Run("with a worker process", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"pid":     1235,
+			"cmdline": "nginx: worker process",
+		})
+
+		item := sdp.Item{
+			Type:            "process",
+			UniqueAttribute: "pid",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		if _, err := ProcessTrigger.ProcessItem(&item); err == nil {
+			t.Error("expected the trigger not to fire for a worker")
+		}
+	})
+}
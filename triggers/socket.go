@@ -0,0 +1,70 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/overmindtech/discovery"
+	"github.com/overmindtech/sdp-go"
+)
+
+// Data required if the TriggerType is "socket"
+type SocketData struct {
+	Address string `json:"address,omitempty"`
+	Port    int    `json:"port,omitempty"`
+
+	// The pid of the process that owns the socket, if known
+	PID int `json:"pid,omitempty"`
+}
+
+// This trigger is based on listening sockets found by port discovery. Any
+// socket owned by an nginx process is used to locate the instance, which also
+// finds instances that other triggers missed. Sockets are identified by their
+// address so the trigger fires on all of them and only generates a request for
+// those owned by nginx
+var SocketTrigger = discovery.Trigger{
+	Type: "socket",
+	RequestGenerator: func(in *sdp.Item) (*sdp.ItemRequest, error) {
+		process := firstAttribute(in, "process", "processName", "program")
+
+		if !strings.HasPrefix(path.Base(process), "nginx") {
+			return nil, fmt.Errorf("socket %v is not owned by nginx", in.UniqueAttributeValue())
+		}
+
+		port, err := strconv.Atoi(firstAttribute(in, "localPort", "port"))
+
+		if err != nil {
+			return nil, fmt.Errorf("socket %v has an invalid port: %v", in.UniqueAttributeValue(), err)
+		}
+
+		// The pid is optional since the port is enough to find the instance
+		pid, _ := strconv.Atoi(firstAttribute(in, "pid"))
+
+		ref := in.Reference()
+
+		td := TriggerData{
+			TriggerType:    SOCKET,
+			TriggerItemRef: &ref,
+			SocketData: &SocketData{
+				Address: firstAttribute(in, "localAddress", "address"),
+				Port:    port,
+				PID:     pid,
+			},
+		}
+
+		b, err := json.Marshal(td)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &sdp.ItemRequest{
+			Type:   "nginx",
+			Method: sdp.RequestMethod_SEARCH,
+			Query:  string(b),
+		}, nil
+	},
+}
@@ -0,0 +1,75 @@
+package triggers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/overmindtech/sdp-go"
+)
+
+func TestSocketTrigger(t *testing.T) {
+	t.Run("with a socket owned by nginx", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"name":         "0.0.0.0:443",
+			"localAddress": "0.0.0.0",
+			"localPort":    443,
+			"process":      "nginx",
+			"pid":          1234,
+		})
+
+		item := sdp.Item{
+			Type:            "socket",
+			UniqueAttribute: "name",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		req, err := SocketTrigger.ProcessItem(&item)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var td TriggerData
+
+		err = json.Unmarshal([]byte(req.Query), &td)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := SOCKET; td.TriggerType != expected {
+			t.Errorf("expected td.TriggerType to be %v, got %v", expected, td.TriggerType)
+		}
+
+		expected := SocketData{Address: "0.0.0.0", Port: 443, PID: 1234}
+
+		if td.SocketData == nil || *td.SocketData != expected {
+			t.Errorf("expected td.SocketData to be %+v, got %+v", expected, td.SocketData)
+		}
+
+		if td.TriggerItemRef == nil || td.TriggerItemRef.UniqueAttributeValue != "0.0.0.0:443" {
+			t.Errorf("expected a reference to the socket, got %v", td.TriggerItemRef)
+		}
+	})
+
+	t.Run("with a socket owned by something else", func(t *testing.T) {
+		attr, _ := sdp.ToAttributes(map[string]interface{}{
+			"name":         "0.0.0.0:443",
+			"localAddress": "0.0.0.0",
+			"localPort":    443,
+			"process":      "haproxy",
+		})
+
+		item := sdp.Item{
+			Type:            "socket",
+			UniqueAttribute: "name",
+			Attributes:      attr,
+			Context:         "test",
+		}
+
+		if _, err := SocketTrigger.ProcessItem(&item); err == nil {
+			t.Error("expected the trigger not to fire")
+		}
+	})
+}